@@ -0,0 +1,425 @@
+package simplets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	. "github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/otsprotocol"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/search"
+)
+
+type aggregationKind int
+
+const (
+	aggCount aggregationKind = iota
+	aggDistinctCount
+	aggSum
+	aggAvg
+	aggMin
+	aggMax
+	groupByField
+	groupByRange
+	groupByFilter
+)
+
+var aggregationKindNames = map[aggregationKind]string{
+	aggCount:         "Count",
+	aggDistinctCount: "DistinctCount",
+	aggSum:           "Sum",
+	aggAvg:           "Avg",
+	aggMin:           "Min",
+	aggMax:           "Max",
+	groupByField:     "GroupByField",
+	groupByRange:     "GroupByRange",
+	groupByFilter:    "GroupByFilter",
+}
+
+// Aggregation is an aggregation or a group by of Aggregate on a struct field with ts_search tag, the field must be
+// declared with the sort option. it is built by Count, DistinctCount, Sum, Avg, Min, Max, GroupByField,
+// GroupByRange and GroupByFilter, the results are keyed by its name
+type Aggregation struct {
+	name    string
+	kind    aggregationKind
+	field   string
+	size    int32
+	ranges  [][2]float64
+	filters []bucketFilter
+	subs    []*Aggregation
+	err     string // misuse of the builder methods
+}
+
+type bucketFilter struct {
+	key   string
+	query *Query
+}
+
+// Count counts the values of field
+func Count(name, field string) *Aggregation {
+	return &Aggregation{name: name, kind: aggCount, field: field}
+}
+
+// DistinctCount counts the distinct values of field
+func DistinctCount(name, field string) *Aggregation {
+	return &Aggregation{name: name, kind: aggDistinctCount, field: field}
+}
+
+// Sum sums the values of a long or double field
+func Sum(name, field string) *Aggregation {
+	return &Aggregation{name: name, kind: aggSum, field: field}
+}
+
+// Avg averages the values of a long or double field
+func Avg(name, field string) *Aggregation {
+	return &Aggregation{name: name, kind: aggAvg, field: field}
+}
+
+// Min returns the min value of a long or double field
+func Min(name, field string) *Aggregation {
+	return &Aggregation{name: name, kind: aggMin, field: field}
+}
+
+// Max returns the max value of a long or double field
+func Max(name, field string) *Aggregation {
+	return &Aggregation{name: name, kind: aggMax, field: field}
+}
+
+// GroupByField groups the rows by the values of field, the buckets are ordered by the row count in descending
+// order. tablestore returns 10 buckets unless Size is set
+func GroupByField(name, field string) *Aggregation {
+	return &Aggregation{name: name, kind: groupByField, field: field}
+}
+
+// GroupByRange groups the rows by the ranges of a long or double field added by Range
+func GroupByRange(name, field string) *Aggregation {
+	return &Aggregation{name: name, kind: groupByRange, field: field}
+}
+
+// GroupByFilter groups the rows by the queries added by Filter, a row may be in several buckets
+func GroupByFilter(name string) *Aggregation {
+	return &Aggregation{name: name, kind: groupByFilter}
+}
+
+// Size sets the max count of buckets of GroupByField
+func (a *Aggregation) Size(n int32) *Aggregation {
+	if a.kind != groupByField {
+		a.err = "Size is only allowed on GroupByField"
+	}
+	a.size = n
+	return a
+}
+
+// Range adds the bucket [from, to) to GroupByRange, math.Inf is allowed for an open range
+func (a *Aggregation) Range(from, to float64) *Aggregation {
+	if a.kind != groupByRange {
+		a.err = "Range is only allowed on GroupByRange"
+	}
+	a.ranges = append(a.ranges, [2]float64{from, to})
+	return a
+}
+
+// Filter adds the bucket of the rows matched by the conditions of q to GroupByFilter, the bucket is keyed by key
+func (a *Aggregation) Filter(key string, q *Query) *Aggregation {
+	if a.kind != groupByFilter {
+		a.err = "Filter is only allowed on GroupByFilter"
+	}
+	a.filters = append(a.filters, bucketFilter{key: key, query: q})
+	return a
+}
+
+// Sub adds aggregations and group bys computed for every bucket of a group by
+func (a *Aggregation) Sub(aggs ...*Aggregation) *Aggregation {
+	if a.kind < groupByField {
+		a.err = "Sub is only allowed on group by"
+	}
+	a.subs = append(a.subs, aggs...)
+	return a
+}
+
+// AggregationResult is the result of Aggregate or of a bucket, the values are keyed by the names of aggregations
+type AggregationResult struct {
+	// TotalCount is the count of all the rows matched by the query, it is 0 for a bucket
+	TotalCount int64
+	// Counts are the results of Count and DistinctCount
+	Counts map[string]int64
+	// Values are the results of Sum, Avg, Min and Max, Avg, Min and Max are absent if the field has no value
+	Values map[string]float64
+	// Buckets are the results of group bys
+	Buckets map[string][]Bucket
+}
+
+// Bucket is a group of rows of a group by
+type Bucket struct {
+	// Key is the value of GroupByField, "[from, to)" of GroupByRange or the key of GroupByFilter
+	Key      string
+	Count    int64
+	From, To float64 // range of GroupByRange
+	// Sub is the result of the sub aggregations
+	Sub *AggregationResult
+}
+
+// BucketCounts returns the row counts of the buckets of group by name keyed by Bucket.Key
+func (r *AggregationResult) BucketCounts(name string) map[string]int64 {
+	counts := make(map[string]int64, len(r.Buckets[name]))
+	for _, b := range r.Buckets[name] {
+		counts[b.Key] = b.Count
+	}
+	return counts
+}
+
+// Aggregate computes aggs over the rows matched by query on the search index declared by struct r, nil query
+// matches all the rows. query is a *Query or a query of the sdk wrapped by SDKQuery, its sort and paging are
+// ignored. a *QueryError is returned if a field is invalid for the aggregation
+func Aggregate(client SearchClient, r interface{}, query SearchQuery, aggs ...*Aggregation) (*AggregationResult, error) {
+	return AggregateCtx(context.Background(), client, r, query, aggs...)
+}
+
+// AggregateCtx is Aggregate with a context
+func AggregateCtx(ctx context.Context, client SearchClient, r interface{}, query SearchQuery, aggs ...*Aggregation) (*AggregationResult, error) {
+	if err := Validate(r); err != nil {
+		return nil, err
+	}
+	s := getSchema(reflect.Indirect(reflect.ValueOf(r)).Type())
+	if query == nil {
+		query = MatchAll()
+	}
+	req, err := searchRequest(s, query)
+	if err != nil {
+		return nil, err
+	}
+	e := &QueryError{Type: s.typ}
+	sdkAggs, groupBys := buildAggregations(s, aggs, e)
+	if len(e.Errors) > 0 {
+		return nil, e
+	}
+	req.SearchQuery = &editedQuery{query: req.SearchQuery, edit: func(pb *otsprotocol.SearchQuery) error {
+		var err error
+		if pb.Aggs, err = search.BuildPBForAggregations(sdkAggs); err != nil {
+			return err
+		}
+		if pb.GroupBys, err = search.BuildPBForGroupBys(groupBys); err != nil {
+			return err
+		}
+		limit, total := int32(0), true
+		pb.Limit, pb.Offset, pb.Sort, pb.Token, pb.GetTotalCount = &limit, nil, nil, nil, &total
+		return nil
+	}}
+	req.ColumnsToGet = nil
+	client, err = bindSearchContext(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Search(req)
+	if err != nil {
+		return nil, substantiateError(err)
+	}
+	result, err := aggregationResult(aggs, resp.AggregationResults, resp.GroupByResults)
+	if err != nil {
+		return nil, err
+	}
+	result.TotalCount = resp.TotalCount
+	return result, nil
+}
+
+// buildAggregations returns the sdk aggregations and group bys of aggs, the problems are appended to e
+func buildAggregations(s *schema, aggs []*Aggregation, e *QueryError) ([]search.Aggregation, []search.GroupBy) {
+	var sdkAggs []search.Aggregation
+	var groupBys []search.GroupBy
+	names := make(map[string]bool)
+	for _, a := range aggs {
+		problem := func(reason string) {
+			field := a.field
+			if field == "" {
+				field = a.name
+			}
+			e.Errors = append(e.Errors, FieldError{Field: field, Reason: reason})
+		}
+		switch {
+		case a.name == "":
+			problem(fmt.Sprintf("%s requires a name", aggregationKindNames[a.kind]))
+			continue
+		case names[a.name]:
+			problem(fmt.Sprintf("name %s is duplicated", a.name))
+			continue
+		case a.err != "":
+			problem(a.err)
+			continue
+		}
+		names[a.name] = true
+
+		var fieldName string
+		if a.kind != groupByFilter {
+			f, err := searchField(s, a.field)
+			if err == nil {
+				err = checkAggregationField(a.kind, f.search)
+			}
+			if err != nil {
+				problem(err.Error())
+				continue
+			}
+			fieldName = f.fieldName
+		}
+		switch a.kind {
+		case aggCount:
+			sdkAggs = append(sdkAggs, search.NewCountAggregation(a.name, fieldName))
+		case aggDistinctCount:
+			sdkAggs = append(sdkAggs, search.NewDistinctCountAggregation(a.name, fieldName))
+		case aggSum:
+			sdkAggs = append(sdkAggs, search.NewSumAggregation(a.name, fieldName))
+		case aggAvg:
+			sdkAggs = append(sdkAggs, search.NewAvgAggregation(a.name, fieldName))
+		case aggMin:
+			sdkAggs = append(sdkAggs, search.NewMinAggregation(a.name, fieldName))
+		case aggMax:
+			sdkAggs = append(sdkAggs, search.NewMaxAggregation(a.name, fieldName))
+		default:
+			subAggs, subGroupBys := buildAggregations(s, a.subs, e)
+			switch a.kind {
+			case groupByField:
+				g := search.NewGroupByField(a.name, fieldName).SubAggregations(subAggs...).SubGroupBys(subGroupBys...)
+				if a.size > 0 {
+					g.Size(a.size)
+				}
+				groupBys = append(groupBys, g)
+			case groupByRange:
+				if len(a.ranges) == 0 {
+					problem("GroupByRange requires at least one Range")
+					continue
+				}
+				g := search.NewGroupByRange(a.name, fieldName).SubAggregations(subAggs...).SubGroupBys(subGroupBys...)
+				for _, r := range a.ranges {
+					g.Range(r[0], r[1])
+				}
+				groupBys = append(groupBys, g)
+			case groupByFilter:
+				if len(a.filters) == 0 {
+					problem("GroupByFilter requires at least one Filter")
+					continue
+				}
+				g := search.NewGroupByFilter(a.name).SubAggregations(subAggs...).SubGroupBys(subGroupBys...)
+				for _, f := range a.filters {
+					if f.query == nil {
+						problem(fmt.Sprintf("query of bucket %s is nil", f.key))
+						continue
+					}
+					g.Query(f.query.query(s, e))
+				}
+				groupBys = append(groupBys, g)
+			}
+		}
+	}
+	return sdkAggs, groupBys
+}
+
+func checkAggregationField(kind aggregationKind, st *searchTag) error {
+	if !st.sortAndAgg {
+		return errors.New("sort option of ts_search tag is required to aggregate")
+	}
+	switch kind {
+	case aggSum, aggAvg, aggMin, aggMax, groupByRange:
+		if st.fieldType != FieldType_LONG && st.fieldType != FieldType_DOUBLE {
+			return fmt.Errorf("%s is only allowed on long and double field", aggregationKindNames[kind])
+		}
+	}
+	return nil
+}
+
+func aggregationResult(aggs []*Aggregation, aggResults search.AggregationResults, groupByResults search.GroupByResults) (*AggregationResult, error) {
+	result := &AggregationResult{
+		Counts:  make(map[string]int64),
+		Values:  make(map[string]float64),
+		Buckets: make(map[string][]Bucket),
+	}
+	for _, a := range aggs {
+		var err error
+		switch a.kind {
+		case aggCount:
+			var r *search.CountAggregationResult
+			if r, err = aggResults.Count(a.name); err == nil {
+				result.Counts[a.name] = r.Value
+			}
+		case aggDistinctCount:
+			var r *search.DistinctCountAggregationResult
+			if r, err = aggResults.DistinctCount(a.name); err == nil {
+				result.Counts[a.name] = r.Value
+			}
+		case aggSum:
+			var r *search.SumAggregationResult
+			if r, err = aggResults.Sum(a.name); err == nil {
+				result.Values[a.name] = r.Value
+			}
+		case aggAvg:
+			var r *search.AvgAggregationResult
+			if r, err = aggResults.Avg(a.name); err == nil && r.HasValue() {
+				result.Values[a.name] = r.Value
+			}
+		case aggMin:
+			var r *search.MinAggregationResult
+			if r, err = aggResults.Min(a.name); err == nil && r.HasValue() {
+				result.Values[a.name] = r.Value
+			}
+		case aggMax:
+			var r *search.MaxAggregationResult
+			if r, err = aggResults.Max(a.name); err == nil && r.HasValue() {
+				result.Values[a.name] = r.Value
+			}
+		case groupByField:
+			var r *search.GroupByFieldResult
+			if r, err = groupByResults.GroupByField(a.name); err != nil {
+				break
+			}
+			buckets := make([]Bucket, 0, len(r.Items))
+			for _, item := range r.Items {
+				b := Bucket{Key: item.Key, Count: item.RowCount}
+				if b.Sub, err = aggregationResult(a.subs, item.SubAggregations, item.SubGroupBys); err != nil {
+					return nil, err
+				}
+				buckets = append(buckets, b)
+			}
+			result.Buckets[a.name] = buckets
+		case groupByRange:
+			var r *search.GroupByRangeResult
+			if r, err = groupByResults.GroupByRange(a.name); err != nil {
+				break
+			}
+			buckets := make([]Bucket, 0, len(r.Items))
+			for _, item := range r.Items {
+				b := Bucket{Key: rangeKey(item.From, item.To), Count: item.RowCount, From: item.From, To: item.To}
+				if b.Sub, err = aggregationResult(a.subs, item.SubAggregations, item.SubGroupBys); err != nil {
+					return nil, err
+				}
+				buckets = append(buckets, b)
+			}
+			result.Buckets[a.name] = buckets
+		case groupByFilter:
+			var r *search.GroupByFilterResult
+			if r, err = groupByResults.GroupByFilter(a.name); err != nil {
+				break
+			}
+			if len(r.Items) != len(a.filters) {
+				return nil, fmt.Errorf("simple-tablestore: expect %d buckets of %s, got %d", len(a.filters), a.name, len(r.Items))
+			}
+			buckets := make([]Bucket, 0, len(r.Items))
+			for i, item := range r.Items {
+				b := Bucket{Key: a.filters[i].key, Count: item.RowCount}
+				if b.Sub, err = aggregationResult(a.subs, item.SubAggregations, item.SubGroupBys); err != nil {
+					return nil, err
+				}
+				buckets = append(buckets, b)
+			}
+			result.Buckets[a.name] = buckets
+		}
+		if err != nil {
+			return nil, fmt.Errorf("simple-tablestore: %v", err)
+		}
+	}
+	return result, nil
+}
+
+// rangeKey formats the bucket of GroupByRange as "[from, to)", infinities are "-Inf" and "+Inf"
+func rangeKey(from, to float64) string {
+	return "[" + strconv.FormatFloat(from, 'g', -1, 64) + ", " + strconv.FormatFloat(to, 'g', -1, 64) + ")"
+}
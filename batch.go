@@ -0,0 +1,304 @@
+package simplets
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"time"
+
+	. "github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+)
+
+// the max rows of one BatchGetRow request allowed by tablestore
+const maxBatchGetRows = 100
+
+// BatchGetRows fills every struct of rs in place like GetRow does, rs are pointers of tagged structs which may
+// belong to different tables. exists[i] reports whether rs[i] is found. rs is split into several BatchGetRow
+// requests automatically if it exceeds the limit of tablestore. FilterOption and ColumnFilterOption are applied
+// to every table, a row dropped by the filter is reported as not existing
+func BatchGetRows(client Client, rs []interface{}, setters ...Option) (exists []bool, err error) {
+	return BatchGetRowsCtx(context.Background(), client, rs, setters...)
+}
+
+// BatchGetRowsCtx is BatchGetRows with a context, it returns ctx.Err() before sending a request if ctx is done
+func BatchGetRowsCtx(ctx context.Context, client Client, rs []interface{}, setters ...Option) (exists []bool, err error) {
+	opts := &Options{}
+	for _, s := range setters {
+		s(opts)
+	}
+	exists = make([]bool, len(rs))
+	for start := 0; start < len(rs); start += maxBatchGetRows {
+		end := start + maxBatchGetRows
+		if end > len(rs) {
+			end = len(rs)
+		}
+		var c Client
+		if c, err = bindContext(ctx, client); err != nil {
+			return exists, err
+		}
+		if err = batchGetRows(c, rs[start:end], exists[start:end], opts); err != nil {
+			return exists, err
+		}
+	}
+	return exists, nil
+}
+
+type batchGetItem struct {
+	v      reflect.Value
+	fields map[string]*fieldInfo
+	index  int
+}
+
+func batchGetRows(client Client, rs []interface{}, exists []bool, opts *Options) error {
+	req := new(BatchGetRowRequest)
+	criteriaOfTable := make(map[string]*MultiRowQueryCriteria)
+	itemsOfTable := make(map[string][]*batchGetItem)
+	for i, r := range rs {
+		v := reflect.ValueOf(r).Elem()
+		t := v.Type()
+		if err := loadSchema(t).err; err != nil {
+			return err
+		}
+		pk, fields, table := generateInfo(v, t)
+		criteria, ok := criteriaOfTable[table]
+		if !ok {
+			filter, err := opts.columnFilterOf(getSchema(t))
+			if err != nil {
+				return err
+			}
+			criteria = &MultiRowQueryCriteria{TableName: table, MaxVersion: 1, Filter: filter}
+			criteriaOfTable[table] = criteria
+			req.MultiRowQueryCriteria = append(req.MultiRowQueryCriteria, criteria)
+		}
+		criteria.AddRow(pk)
+		itemsOfTable[table] = append(itemsOfTable[table], &batchGetItem{v: v, fields: fields, index: i})
+	}
+	resp, err := client.BatchGetRow(req)
+	if err != nil {
+		return substantiateError(err)
+	}
+	for table, items := range itemsOfTable {
+		results := resp.TableToRowsResult[table]
+		if len(results) != len(items) {
+			return fmt.Errorf("batch get rows of table %s: expect %d results, got %d", table, len(items), len(results))
+		}
+		// results of a table are in the same order as the primary keys in request
+		for i, item := range items {
+			result := results[i]
+			if !result.IsSucceed {
+				return substantiateRowError(result.Error, resp.RequestId)
+			}
+			if result.PrimaryKey.PrimaryKeys == nil {
+				continue
+			}
+			fillColsToFieldInfos(result.Columns, item.fields)
+			fillStructFromFields(item.v, item.fields)
+			exists[item.index] = true
+		}
+	}
+	return nil
+}
+
+// the max rows of one BatchWriteRow request allowed by tablestore
+const maxBatchWriteRows = 200
+
+const (
+	defaultBatchWriteRetryTimes    = 3
+	defaultBatchWriteRetryInterval = 50 * time.Millisecond
+	maxBatchWriteRetryInterval     = 2 * time.Second
+)
+
+type batchWriteOp int
+
+const (
+	batchWritePut batchWriteOp = iota
+	batchWriteUpdate
+	batchWriteDelete
+)
+
+type batchWriteEntry struct {
+	r    interface{}
+	op   batchWriteOp
+	opts *Options
+}
+
+// BatchWrite collects PutRow, UpdateRow and DeleteRow of tagged structs, which may belong to different tables,
+// and sends them by BatchWriteRow when Do is called
+type BatchWrite struct {
+	entries       []*batchWriteEntry
+	retryTimes    int
+	retryInterval time.Duration
+}
+
+// BatchWriteResult is the result of a row added to BatchWrite
+type BatchWriteResult struct {
+	// Row is the struct added to BatchWrite
+	Row interface{}
+	// Err is the error of this row, it can be checked with errors.Is(err, ErrConditionCheckFail) and so on
+	Err error
+}
+
+func NewBatchWrite() *BatchWrite {
+	return &BatchWrite{
+		retryTimes:    defaultBatchWriteRetryTimes,
+		retryInterval: defaultBatchWriteRetryInterval,
+	}
+}
+
+func (b *BatchWrite) add(r interface{}, op batchWriteOp, setters []Option) *BatchWrite {
+	opts := &Options{}
+	for _, s := range setters {
+		s(opts)
+	}
+	b.entries = append(b.entries, &batchWriteEntry{r: r, op: op, opts: opts})
+	return b
+}
+
+// PutRow adds a row to put, it accepts the same options as PutRow
+func (b *BatchWrite) PutRow(r interface{}, setters ...Option) *BatchWrite {
+	return b.add(r, batchWritePut, setters)
+}
+
+// UpdateRow adds a row to update, it accepts the same options as UpdateRow
+func (b *BatchWrite) UpdateRow(r interface{}, setters ...Option) *BatchWrite {
+	return b.add(r, batchWriteUpdate, setters)
+}
+
+// DeleteRow adds a row to delete, it accepts the same options as DeleteRow
+func (b *BatchWrite) DeleteRow(r interface{}, setters ...Option) *BatchWrite {
+	return b.add(r, batchWriteDelete, setters)
+}
+
+// Retry sets how many times the rows failed with a retriable error(throttling, server busy and so on) are
+// resubmitted, the interval doubles on every retry. by default they are retried 3 times starting from 50ms,
+// Retry(0, 0) disables it, negative times and interval are taken as 0
+func (b *BatchWrite) Retry(times int, interval time.Duration) *BatchWrite {
+	if times < 0 {
+		times = 0
+	}
+	if interval < 0 {
+		interval = 0
+	}
+	b.retryTimes = times
+	b.retryInterval = interval
+	return b
+}
+
+// Len returns the count of rows added
+func (b *BatchWrite) Len() int {
+	return len(b.entries)
+}
+
+// Do sends all rows, split into several BatchWriteRow requests if they exceed the limit of tablestore.
+// results are in the same order as rows are added, a row failed alone is reported by its BatchWriteResult.Err
+// after the retries are used up. err is returned only if a whole request fails, then the rows not written
+// carry it as their BatchWriteResult.Err.
+// unlike PutRow and UpdateRow, nothing is filled back to the structs, BatchWriteRow of tablestore sdk v1.5.0 does
+// not return the auto increment primary keys or the columns, read the rows to get them
+func (b *BatchWrite) Do(client Client) (results []BatchWriteResult, err error) {
+	return b.DoCtx(context.Background(), client)
+}
+
+// DoCtx is Do with a context, it stops before sending a request or during the retry interval once ctx is done,
+// then ctx.Err() is returned and carried by the rows not written
+func (b *BatchWrite) DoCtx(ctx context.Context, client Client) (results []BatchWriteResult, err error) {
+	results = make([]BatchWriteResult, len(b.entries))
+	pending := make([]int, len(b.entries))
+	for i, e := range b.entries {
+		results[i].Row = e.r
+		pending[i] = i
+	}
+	interval := b.retryInterval
+	for retry := 0; ; retry++ {
+		var retriable []int
+		for start := 0; start < len(pending); start += maxBatchWriteRows {
+			end := start + maxBatchWriteRows
+			if end > len(pending) {
+				end = len(pending)
+			}
+			var c Client
+			var failed []int
+			if c, err = bindContext(ctx, client); err == nil {
+				failed, err = b.writeRows(c, pending[start:end], results)
+			}
+			if err != nil {
+				for _, i := range pending[start:] {
+					results[i].Err = err
+				}
+				return results, err
+			}
+			retriable = append(retriable, failed...)
+		}
+		if len(retriable) == 0 || retry >= b.retryTimes {
+			return results, nil
+		}
+		timer := time.NewTimer(interval/2 + time.Duration(rand.Int63n(int64(interval/2)+1)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			for _, i := range retriable {
+				results[i].Err = ctx.Err()
+			}
+			return results, ctx.Err()
+		case <-timer.C:
+		}
+		if interval *= 2; interval > maxBatchWriteRetryInterval {
+			interval = maxBatchWriteRetryInterval
+		}
+		pending = retriable
+	}
+}
+
+type batchWriteItem struct {
+	index int
+}
+
+// writeRows writes the entries at indexes in one request, it returns the indexes of rows failed with a retriable error
+func (b *BatchWrite) writeRows(client Client, indexes []int, results []BatchWriteResult) (retriable []int, err error) {
+	req := new(BatchWriteRowRequest)
+	itemsOfTable := make(map[string][]*batchWriteItem)
+	for _, i := range indexes {
+		e := b.entries[i]
+		v := reflect.ValueOf(e.r).Elem()
+		t := v.Type()
+		var change RowChange
+		switch e.op {
+		case batchWritePut:
+			change, _, err = buildPutRowChange(v, t, e.opts)
+		case batchWriteUpdate:
+			change, _, err = buildUpdateRowChange(v, t, e.opts)
+		case batchWriteDelete:
+			change, err = buildDeleteRowChange(v, t, e.opts)
+		}
+		if err != nil {
+			return nil, err
+		}
+		req.AddRowChange(change)
+		table := change.GetTableName()
+		itemsOfTable[table] = append(itemsOfTable[table], &batchWriteItem{index: i})
+	}
+	resp, err := client.BatchWriteRow(req)
+	if err != nil {
+		return nil, substantiateError(err)
+	}
+	for table, items := range itemsOfTable {
+		rowResults := resp.TableToRowsResult[table]
+		if len(rowResults) != len(items) {
+			return nil, fmt.Errorf("batch write rows of table %s: expect %d results, got %d", table, len(items), len(rowResults))
+		}
+		// results of a table are in the same order as the row changes in request
+		for i, item := range items {
+			result := rowResults[i]
+			if !result.IsSucceed {
+				results[item.index].Err = substantiateRowError(result.Error, resp.RequestId)
+				if isRetriableCode(result.Error.Code, result.Error.Message) {
+					retriable = append(retriable, item.index)
+				}
+				continue
+			}
+			results[item.index].Err = nil
+		}
+	}
+	return retriable, nil
+}
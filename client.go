@@ -0,0 +1,42 @@
+package simplets
+
+import (
+	"context"
+
+	. "github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+)
+
+// Client is the subset of tablestore api that simplets depends on, *TableStoreClient satisfies it,
+// so does any fake or wrapper(e.g. metrics, tracing) that implements these methods
+type Client interface {
+	GetRow(request *GetRowRequest) (*GetRowResponse, error)
+	PutRow(request *PutRowRequest) (*PutRowResponse, error)
+	UpdateRow(request *UpdateRowRequest) (*UpdateRowResponse, error)
+	DeleteRow(request *DeleteRowRequest) (*DeleteRowResponse, error)
+	GetRange(request *GetRangeRequest) (*GetRangeResponse, error)
+	DescribeTable(request *DescribeTableRequest) (*DescribeTableResponse, error)
+	CreateTable(request *CreateTableRequest) (*CreateTableResponse, error)
+	BatchGetRow(request *BatchGetRowRequest) (*BatchGetRowResponse, error)
+	BatchWriteRow(request *BatchWriteRowRequest) (*BatchWriteRowResponse, error)
+}
+
+var _ Client = (*TableStoreClient)(nil)
+
+// ContextBinder is implemented by clients which can carry a context to the requests they send, e.g. to pass the
+// deadline and cancellation down to http calls. the Ctx variants of operations send requests by the client
+// returned from WithContext if the client implements it.
+// tablestore sdk v1.5.0 has no context support, so *TableStoreClient only gets the checks between requests
+type ContextBinder interface {
+	WithContext(ctx context.Context) Client
+}
+
+// bindContext returns ctx.Err() if ctx is done, otherwise the client to send requests within ctx
+func bindContext(ctx context.Context, client Client) (Client, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if binder, ok := client.(ContextBinder); ok {
+		return binder.WithContext(ctx), nil
+	}
+	return client, nil
+}
@@ -1,38 +1,64 @@
 package simplets
 
 import (
-	"fmt"
+	"context"
 	"reflect"
 
 	. "github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
 )
 
-var ErrConditionCheckFail = fmt.Errorf("OTSConditionCheckFail")
-var ErrObjectNotExist = fmt.Errorf("OTSObjectNotExist")
+func GetRow(client Client, r interface{}, setters ...Option) (bool, error) {
+	return GetRowCtx(context.Background(), client, r, setters...)
+}
 
-func GetRow(client *TableStoreClient, r interface{}) (bool, error) {
+// GetRowCtx is GetRow with a context, it returns ctx.Err() without sending request if ctx is done
+func GetRowCtx(ctx context.Context, client Client, r interface{}, setters ...Option) (bool, error) {
+	client, err := bindContext(ctx, client)
+	if err != nil {
+		return false, err
+	}
+	opts := &Options{}
+	for _, s := range setters {
+		s(opts)
+	}
 	getRowRequest := new(GetRowRequest)
 	criteria := new(SingleRowQueryCriteria)
 
 	v := reflect.ValueOf(r).Elem()
 	t := v.Type()
+	s := loadSchema(t)
+	if s.err != nil {
+		return false, s.err
+	}
 	pk, fields, table := generateInfo(v, t)
+	projection, err := projectColumns(s, opts.columns)
+	if err != nil {
+		return false, err
+	}
+	filter, err := opts.columnFilterOf(s)
+	if err != nil {
+		return false, err
+	}
 
 	criteria.PrimaryKey = pk
 	getRowRequest.SingleRowQueryCriteria = criteria
 	getRowRequest.SingleRowQueryCriteria.TableName = table
 	getRowRequest.SingleRowQueryCriteria.MaxVersion = 1
+	criteria.Filter = filter
+	if projection != nil {
+		criteria.ColumnsToGet, criteria.StartColumn, criteria.EndColumn = projection.columns, projection.start, projection.end
+	}
 	getResp, err := client.GetRow(getRowRequest)
 	if err != nil {
-		return false, err
+		return false, substantiateError(err)
 	}
 	if getResp.PrimaryKey.PrimaryKeys == nil {
 		return false, nil
 	}
 
-	columns := getResp.Columns
+	columns := projection.project(getResp.Columns)
 	fillColsToFieldInfos(columns, fields)
-	fillStructFromFields(t, v, fields)
+	fillStructFromFields(v, fields)
 	return true, nil
 }
 
@@ -58,7 +84,16 @@ func getSupportedValue(i interface{}) interface{} {
 	return v
 }
 
-func PutRow(client *TableStoreClient, r interface{}, setters ...Option) error {
+func PutRow(client Client, r interface{}, setters ...Option) error {
+	return PutRowCtx(context.Background(), client, r, setters...)
+}
+
+// PutRowCtx is PutRow with a context, it returns ctx.Err() without sending request if ctx is done
+func PutRowCtx(ctx context.Context, client Client, r interface{}, setters ...Option) error {
+	client, err := bindContext(ctx, client)
+	if err != nil {
+		return err
+	}
 	opts := &Options{}
 	for _, s := range setters {
 		s(opts)
@@ -67,6 +102,24 @@ func PutRow(client *TableStoreClient, r interface{}, setters ...Option) error {
 	t := v.Type()
 
 	rowRequest := new(PutRowRequest)
+	rowChange, fields, err := buildPutRowChange(v, t, opts)
+	if err != nil {
+		return err
+	}
+	rowRequest.PutRowChange = rowChange
+	resp, err := client.PutRow(rowRequest)
+	if err != nil {
+		return substantiateError(err)
+	}
+	fillPKsToFieldInfos(resp.PrimaryKey, fields)
+	fillStructFromFields(v, fields)
+	return nil
+}
+
+func buildPutRowChange(v reflect.Value, t reflect.Type, opts *Options) (*PutRowChange, map[string]*fieldInfo, error) {
+	if err := loadSchema(t).err; err != nil {
+		return nil, nil, err
+	}
 	rowChange := new(PutRowChange)
 	pk, fields, table := generateInfo(v, t)
 	rowChange.TableName = table
@@ -86,20 +139,26 @@ func PutRow(client *TableStoreClient, r interface{}, setters ...Option) error {
 		}
 	}
 	rowChange.SetCondition(opts.rowExistence)
-	if opts.columnFilter != nil {
-		rowChange.SetColumnCondition(opts.columnFilter)
-	}
-	rowRequest.PutRowChange = rowChange
-	resp, err := client.PutRow(rowRequest)
+	filter, err := opts.columnFilterOf(getSchema(t))
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-	fillPKsToFieldInfos(resp.PrimaryKey, fields)
-	fillStructFromFields(t, v, fields)
-	return err
+	if filter != nil {
+		rowChange.SetColumnCondition(filter)
+	}
+	return rowChange, fields, nil
+}
+
+func UpdateRow(client Client, r interface{}, setters ...Option) error {
+	return UpdateRowCtx(context.Background(), client, r, setters...)
 }
 
-func UpdateRow(client *TableStoreClient, r interface{}, setters ...Option) error {
+// UpdateRowCtx is UpdateRow with a context, it returns ctx.Err() without sending request if ctx is done
+func UpdateRowCtx(ctx context.Context, client Client, r interface{}, setters ...Option) error {
+	client, err := bindContext(ctx, client)
+	if err != nil {
+		return err
+	}
 	opts := &Options{}
 	for _, s := range setters {
 		s(opts)
@@ -108,6 +167,25 @@ func UpdateRow(client *TableStoreClient, r interface{}, setters ...Option) error
 	t := v.Type()
 
 	rowRequest := new(UpdateRowRequest)
+	rowChange, fields, err := buildUpdateRowChange(v, t, opts)
+	if err != nil {
+		return err
+	}
+	rowRequest.UpdateRowChange = rowChange
+	resp, err := client.UpdateRow(rowRequest)
+	if err != nil {
+		return substantiateError(err)
+	}
+	columns := resp.Columns
+	fillColsToFieldInfos(columns, fields)
+	fillStructFromFields(v, fields)
+	return nil
+}
+
+func buildUpdateRowChange(v reflect.Value, t reflect.Type, opts *Options) (*UpdateRowChange, map[string]*fieldInfo, error) {
+	if err := loadSchema(t).err; err != nil {
+		return nil, nil, err
+	}
 	rowChange := new(UpdateRowChange)
 	pk, fields, table := generateInfo(v, t)
 	rowChange.TableName = table
@@ -140,38 +218,56 @@ func UpdateRow(client *TableStoreClient, r interface{}, setters ...Option) error
 		rowChange.ColumnNamesToReturn = incColumnsToReturn
 	}
 	rowChange.SetCondition(opts.rowExistence)
-	if opts.columnFilter != nil {
-		rowChange.SetColumnCondition(opts.columnFilter)
-	}
-	rowRequest.UpdateRowChange = rowChange
-	resp, err := client.UpdateRow(rowRequest)
+	filter, err := opts.columnFilterOf(getSchema(t))
 	if err != nil {
-		return substantiateError(err)
+		return nil, nil, err
 	}
-	columns := resp.Columns
-	fillColsToFieldInfos(columns, fields)
-	fillStructFromFields(t, v, fields)
-	return nil
+	if filter != nil {
+		rowChange.SetColumnCondition(filter)
+	}
+	return rowChange, fields, nil
 }
 
-func DeleteRow(client *TableStoreClient, r interface{}, setters ...Option) error {
+func DeleteRow(client Client, r interface{}, setters ...Option) error {
+	return DeleteRowCtx(context.Background(), client, r, setters...)
+}
+
+// DeleteRowCtx is DeleteRow with a context, it returns ctx.Err() without sending request if ctx is done
+func DeleteRowCtx(ctx context.Context, client Client, r interface{}, setters ...Option) error {
+	client, err := bindContext(ctx, client)
+	if err != nil {
+		return err
+	}
 	opts := &Options{}
 	for _, s := range setters {
 		s(opts)
 	}
 	v := reflect.ValueOf(r).Elem()
 	t := v.Type()
-	pk, _, table := generateInfo(v, t)
 
 	rowRequest := new(DeleteRowRequest)
+	if rowRequest.DeleteRowChange, err = buildDeleteRowChange(v, t, opts); err != nil {
+		return err
+	}
+	_, err = client.DeleteRow(rowRequest)
+	return substantiateError(err)
+}
+
+func buildDeleteRowChange(v reflect.Value, t reflect.Type, opts *Options) (*DeleteRowChange, error) {
+	if err := loadSchema(t).err; err != nil {
+		return nil, err
+	}
+	pk, _, table := generateInfo(v, t)
 	rowChange := new(DeleteRowChange)
 	rowChange.TableName = table
 	rowChange.PrimaryKey = pk
 	rowChange.SetCondition(opts.rowExistence)
-	if opts.columnFilter != nil {
-		rowChange.SetColumnCondition(opts.columnFilter)
+	filter, err := opts.columnFilterOf(getSchema(t))
+	if err != nil {
+		return nil, err
 	}
-	rowRequest.DeleteRowChange = rowChange
-	_, err := client.DeleteRow(rowRequest)
-	return substantiateError(err)
+	if filter != nil {
+		rowChange.SetColumnCondition(filter)
+	}
+	return rowChange, nil
 }
@@ -1,96 +1,157 @@
 package simplets
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"reflect"
+	"strings"
 
 	. "github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
 )
 
-func EnsureTable(client *TableStoreClient, r interface{}, opts ...EnsureTableOption) {
-	var opt EnsureTableOption
-	if len(opts) == 1 {
-		opt = opts[0]
+// EnsureTable is EnsureTableE but panics if any error occurs, except that the changes not applied for a client
+// without TableUpdater are ignored, use EnsureTableE or MigrateTable to get them
+func EnsureTable(client Client, r interface{}, opts ...EnsureTableOption) {
+	if err := EnsureTableE(client, r, opts...); err != nil && !errors.Is(err, ErrUpdateTableUnsupported) {
+		panic(err)
 	}
-	table, pkFields, _ := getTableInfoFromStruct(r)
-	resp, err := client.DescribeTable(&DescribeTableRequest{TableName: table})
-	if err != nil {
-		tableNotExistErr := IsObjectNotExist(err)
-		if !tableNotExistErr {
-			panic(err)
-		}
-		if tableNotExistErr && opt.PanicIfTableNotExist {
-			panic("table is not exist")
-		}
-		// create the table on demanded
-		meta := &TableMeta{
-			TableName: table,
-		}
-		for _, field := range pkFields {
-			var pkType PrimaryKeyType
-			switch field.kind {
-			case reflect.Int64:
-				pkType = PrimaryKeyType_INTEGER
-			case reflect.String:
-				pkType = PrimaryKeyType_STRING
-			case reflect.Slice:
-				if reflect.ValueOf(field.value).Type() == typeOfBytes {
-					pkType = PrimaryKeyType_BINARY
-				} else {
-					panic("primary key type can only be string, int64, binary")
-				}
-			default:
-				panic("primary key type can only be string, int64, binary")
-			}
-			if field.isAutoIncPk {
-				meta.AddPrimaryKeyColumnOption(field.fieldName, pkType, AUTO_INCREMENT)
-			} else {
-				meta.AddPrimaryKeyColumn(field.fieldName, pkType)
-			}
-		}
-		// use the most simple option if user not provide
-		option := &TableOption{
-			TimeToAlive: -1,
-			MaxVersion:  1,
-		}
-		if opt.TableOption != nil {
-			option = opt.TableOption
-		}
-		throughput := new(ReservedThroughput)
-		if opt.ReservedThroughput != nil {
-			throughput = opt.ReservedThroughput
-		}
-		req := &CreateTableRequest{
-			TableMeta:          meta,
-			TableOption:        option,
-			ReservedThroughput: throughput,
-			StreamSpec:         opt.StreamSpec,
-			IndexMetas:         opt.IndexMetas,
-		}
-		_, err = client.CreateTable(req)
-		if err != nil {
-			panic(err)
+}
+
+// EnsureTableE makes sure the table of struct r exists, the table is created if it does not exist, unless
+// EnsureTableOption.PanicIfTableNotExist is set, then an error matching ErrObjectNotExist is returned.
+// if the table exists, its primary keys must match the struct, otherwise a *SchemaMismatchError is returned,
+// and the safe changes found by MigrateTable are applied. if client does not implement TableUpdater, nothing is
+// applied and a *UpdateTableUnsupportedError listing the changes is returned
+func EnsureTableE(client Client, r interface{}, opts ...EnsureTableOption) error {
+	return EnsureTableCtx(context.Background(), client, r, opts...)
+}
+
+// EnsureTableCtx is EnsureTableE with a context
+func EnsureTableCtx(ctx context.Context, client Client, r interface{}, opts ...EnsureTableOption) error {
+	_, err := MigrateTableCtx(ctx, client, r, opts...)
+	return err
+}
+
+func createTable(client Client, s *schema, opt EnsureTableOption) error {
+	// create the table on demanded
+	meta := &TableMeta{
+		TableName:      s.table,
+		DefinedColumns: definedColumns(s),
+	}
+	for _, field := range s.pks {
+		if field.isAutoIncPk {
+			meta.AddPrimaryKeyColumnOption(field.fieldName, primaryKeyType(field.typ), AUTO_INCREMENT)
+		} else {
+			meta.AddPrimaryKeyColumn(field.fieldName, primaryKeyType(field.typ))
 		}
-		return
 	}
-	mustMatchPrimaryKeys(pkFields, resp.TableMeta.SchemaEntry)
-	//todo: check DefinedColumns
+	// use the most simple option if user not provide
+	option := &TableOption{
+		TimeToAlive: -1,
+		MaxVersion:  1,
+	}
+	if opt.TableOption != nil {
+		option = opt.TableOption
+	}
+	throughput := new(ReservedThroughput)
+	if opt.ReservedThroughput != nil {
+		throughput = opt.ReservedThroughput
+	}
+	req := &CreateTableRequest{
+		TableMeta:          meta,
+		TableOption:        option,
+		ReservedThroughput: throughput,
+		StreamSpec:         opt.StreamSpec,
+		IndexMetas:         indexMetas(s, opt),
+	}
+	_, err := client.CreateTable(req)
+	return substantiateError(err)
+}
+
+// primaryKeyType returns the tablestore type of a primary key field, the field type is checked by Validate
+func primaryKeyType(t reflect.Type) PrimaryKeyType {
+	switch t.Kind() {
+	case reflect.Int64:
+		return PrimaryKeyType_INTEGER
+	case reflect.String:
+		return PrimaryKeyType_STRING
+	}
+	return PrimaryKeyType_BINARY
+}
+
+// PrimaryKeyMismatch is a primary key which differs between the struct and the table
+type PrimaryKeyMismatch struct {
+	// Index is the position of the primary key
+	Index int
+	// Expected is the primary key defined by struct, nil if the table has more primary keys than the struct
+	Expected *PrimaryKeySchema
+	// Actual is the primary key of the table, nil if the struct has more primary keys than the table
+	Actual *PrimaryKeySchema
+}
+
+// SchemaMismatchError is returned by EnsureTableE if the primary keys of an existing table do not match the struct
+type SchemaMismatchError struct {
+	Table       string
+	PrimaryKeys []PrimaryKeyMismatch
 }
 
-func mustMatchPrimaryKeys(fields []*fieldInfo, pkSchemas []*PrimaryKeySchema) {
-	if len(fields) != len(pkSchemas) {
-		panic("primary key count is not match")
+func (e *SchemaMismatchError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "simple-tablestore: primary keys of table %s do not match the struct:", e.Table)
+	for _, m := range e.PrimaryKeys {
+		fmt.Fprintf(&b, " #%d expect %s, got %s;", m.Index, formatPrimaryKeySchema(m.Expected), formatPrimaryKeySchema(m.Actual))
 	}
-	for i, schema := range pkSchemas {
-		f := fields[i]
-		if *schema.Name != f.fieldName {
-			panic(fmt.Sprintf("primary key name is not match, %s != %s", *schema.Name, f.fieldName))
+	return strings.TrimSuffix(b.String(), ";")
+}
+
+func formatPrimaryKeySchema(pk *PrimaryKeySchema) string {
+	if pk == nil {
+		return "none"
+	}
+	var typ string
+	switch *pk.Type {
+	case PrimaryKeyType_INTEGER:
+		typ = "INTEGER"
+	case PrimaryKeyType_STRING:
+		typ = "STRING"
+	case PrimaryKeyType_BINARY:
+		typ = "BINARY"
+	}
+	if isAutoIncrement(pk) {
+		return fmt.Sprintf("%s %s AUTO_INCREMENT", *pk.Name, typ)
+	}
+	return fmt.Sprintf("%s %s", *pk.Name, typ)
+}
+
+func isAutoIncrement(pk *PrimaryKeySchema) bool {
+	return pk.Option != nil && *pk.Option == AUTO_INCREMENT
+}
+
+func matchPrimaryKeys(s *schema, pkSchemas []*PrimaryKeySchema) error {
+	e := &SchemaMismatchError{Table: s.table}
+	for i := 0; i < len(s.pks) || i < len(pkSchemas); i++ {
+		m := PrimaryKeyMismatch{Index: i}
+		if i < len(s.pks) {
+			f := s.pks[i]
+			name := f.fieldName
+			pkType := primaryKeyType(f.typ)
+			m.Expected = &PrimaryKeySchema{Name: &name, Type: &pkType}
+			if f.isAutoIncPk {
+				option := AUTO_INCREMENT
+				m.Expected.Option = &option
+			}
 		}
-		if schema.Option == nil {
-			continue
+		if i < len(pkSchemas) {
+			m.Actual = pkSchemas[i]
 		}
-		if *schema.Option == AUTO_INCREMENT && !f.isAutoIncPk {
-			panic(fmt.Sprintf("primary key is AUTO_INCREMENT, %s, but tag is not define by ts_pk_+", f.fieldName))
+		if m.Expected == nil || m.Actual == nil || *m.Expected.Name != *m.Actual.Name ||
+			*m.Expected.Type != *m.Actual.Type || isAutoIncrement(m.Expected) != isAutoIncrement(m.Actual) {
+			e.PrimaryKeys = append(e.PrimaryKeys, m)
 		}
 	}
+	if len(e.PrimaryKeys) > 0 {
+		return e
+	}
+	return nil
 }
@@ -0,0 +1,151 @@
+package simplets
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	. "github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+)
+
+// sentinel errors of tablestore error codes, errors returned by simplets can be checked with errors.Is,
+// e.g. errors.Is(err, ErrConditionCheckFail)
+var (
+	ErrAuthFailed                = errors.New("OTSAuthFailed")
+	ErrRequestBodyTooLarge       = errors.New("OTSRequestBodyTooLarge")
+	ErrRequestTimeout            = errors.New("OTSRequestTimeout")
+	ErrMethodNotAllowed          = errors.New("OTSMethodNotAllowed")
+	ErrParameterInvalid          = errors.New("OTSParameterInvalid")
+	ErrInvalidPK                 = errors.New("OTSInvalidPK")
+	ErrOutOfColumnCountLimit     = errors.New("OTSOutOfColumnCountLimit")
+	ErrOutOfRowSizeLimit         = errors.New("OTSOutOfRowSizeLimit")
+	ErrObjectNotExist            = errors.New("OTSObjectNotExist")
+	ErrObjectAlreadyExist        = errors.New("OTSObjectAlreadyExist")
+	ErrConditionCheckFail        = errors.New("OTSConditionCheckFail")
+	ErrRowOperationConflict      = errors.New(ROW_OPERATION_CONFLICT)
+	ErrNotEnoughCapacityUnit     = errors.New(NOT_ENOUGH_CAPACITY_UNIT)
+	ErrCapacityUnitExhausted     = errors.New("OTSCapacityUnitExhausted")
+	ErrTooFrequentThroughputTune = errors.New("OTSTooFrequentReservedThroughputAdjustment")
+	ErrQuotaExhausted            = errors.New(QUOTA_EXHAUSTED)
+	ErrTableNotReady             = errors.New(TABLE_NOT_READY)
+	ErrPartitionUnavailable      = errors.New(PARTITION_UNAVAILABLE)
+	ErrServerBusy                = errors.New(SERVER_BUSY)
+	ErrStorageServerBusy         = errors.New(STORAGE_SERVER_BUSY)
+	ErrTimeout                   = errors.New(STORAGE_TIMEOUT)
+	ErrServerUnavailable         = errors.New(SERVER_UNAVAILABLE)
+	ErrInternalServerError       = errors.New(INTERNAL_SERVER_ERROR)
+)
+
+// sentinelErrorList is in a fixed order, so the codes in an error text are matched deterministically
+var sentinelErrorList = []error{
+	ErrAuthFailed, ErrRequestBodyTooLarge, ErrRequestTimeout, ErrMethodNotAllowed, ErrParameterInvalid,
+	ErrInvalidPK, ErrOutOfColumnCountLimit, ErrOutOfRowSizeLimit, ErrObjectNotExist, ErrObjectAlreadyExist,
+	ErrConditionCheckFail, ErrRowOperationConflict, ErrNotEnoughCapacityUnit, ErrCapacityUnitExhausted,
+	ErrTooFrequentThroughputTune, ErrQuotaExhausted, ErrTableNotReady, ErrPartitionUnavailable, ErrServerBusy,
+	ErrStorageServerBusy, ErrTimeout, ErrServerUnavailable, ErrInternalServerError,
+}
+
+var sentinelErrors = make(map[string]error)
+
+func init() {
+	for _, err := range sentinelErrorList {
+		sentinelErrors[err.Error()] = err
+	}
+}
+
+// TableStoreError is the error returned by tablestore, it matches the sentinel error of its code with errors.Is,
+// and unwraps to the original error of the client
+type TableStoreError struct {
+	Code       string
+	Message    string
+	RequestID  string
+	HTTPStatus int
+	// Retriable reports whether the request can be sent again whatever the operation is, e.g. OTSServerBusy
+	Retriable bool
+
+	err error
+}
+
+func (e *TableStoreError) Error() string {
+	if e.RequestID == "" {
+		return fmt.Sprintf("%s %s", e.Code, e.Message)
+	}
+	return fmt.Sprintf("%s %s %s", e.Code, e.Message, e.RequestID)
+}
+
+func (e *TableStoreError) Unwrap() error {
+	return e.err
+}
+
+func (e *TableStoreError) Is(target error) bool {
+	sentinel, ok := sentinelErrors[e.Code]
+	return ok && sentinel == target
+}
+
+// isRetriableCode reports whether an error code is transient, a request failed with it can be sent again.
+// it follows the rule of tablestore sdk for the errors that are retriable whatever the operation is
+func isRetriableCode(code, message string) bool {
+	switch code {
+	case ROW_OPERATION_CONFLICT, NOT_ENOUGH_CAPACITY_UNIT, TABLE_NOT_READY, PARTITION_UNAVAILABLE,
+		SERVER_BUSY, STORAGE_SERVER_BUSY:
+		return true
+	case QUOTA_EXHAUSTED:
+		return message == "Too frequent table operations."
+	}
+	return false
+}
+
+func IsObjectNotExist(err error) bool {
+	return errors.Is(substantiateError(err), ErrObjectNotExist)
+}
+
+func IsConditionCheckFail(err error) bool {
+	return errors.Is(substantiateError(err), ErrConditionCheckFail)
+}
+
+// IsRetriable reports whether err is a transient tablestore error
+func IsRetriable(err error) bool {
+	var e *TableStoreError
+	return errors.As(substantiateError(err), &e) && e.Retriable
+}
+
+// substantiateError converts the error of client to *TableStoreError if it carries a tablestore error code
+func substantiateError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *TableStoreError
+	if errors.As(err, &e) {
+		return err
+	}
+	var otsErr *OtsError
+	if errors.As(err, &otsErr) {
+		return &TableStoreError{
+			Code:       otsErr.Code,
+			Message:    otsErr.Message,
+			RequestID:  otsErr.RequestId,
+			HTTPStatus: otsErr.HttpStatusCode,
+			Retriable:  isRetriableCode(otsErr.Code, otsErr.Message),
+			err:        err,
+		}
+	}
+	// a fake or wrapper of client may return errors which only carry the code in text
+	msg := err.Error()
+	for _, sentinel := range sentinelErrorList {
+		if code := sentinel.Error(); strings.Contains(msg, code) {
+			return &TableStoreError{Code: code, Message: msg, Retriable: isRetriableCode(code, msg), err: err}
+		}
+	}
+	return err
+}
+
+// substantiateRowError is substantiateError for the per row error of batch operations
+func substantiateRowError(e Error, requestID string) error {
+	return &TableStoreError{
+		Code:      e.Code,
+		Message:   e.Message,
+		RequestID: requestID,
+		Retriable: isRetriableCode(e.Code, e.Message),
+		err:       &OtsError{Code: e.Code, Message: e.Message, RequestId: requestID},
+	}
+}
@@ -0,0 +1,109 @@
+package simplets
+
+import (
+	"fmt"
+
+	. "github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+)
+
+// Filter is a column filter built by the names of struct fields, it is converted into SingleColumnCondition and
+// CompositeColumnValueFilter of the sdk for the struct type of the read or write, e.g.
+//
+//	AllOf(Cond("Age", CT_GREATER_EQUAL, 18), Cond("Name", CT_NOT_EQUAL, "bob").FilterIfMissing(true))
+//
+// only the latest version of a column is compared and a row without the column passes the condition by default
+type Filter struct {
+	field             string
+	comparator        ComparatorType
+	value             interface{}
+	operator          LogicalOperator // operator of composite filter, 0 for a single condition
+	filters           []*Filter
+	latestVersionOnly *bool
+	filterIfMissing   *bool
+}
+
+// Cond returns a filter comparing the column of field with value, field must be a ts_col field
+func Cond(field string, comparator ComparatorType, value interface{}) *Filter {
+	return &Filter{field: field, comparator: comparator, value: value}
+}
+
+// AllOf returns a filter passing the rows which pass all of filters
+func AllOf(filters ...*Filter) *Filter {
+	return &Filter{operator: LO_AND, filters: filters}
+}
+
+// AnyOf returns a filter passing the rows which pass any of filters
+func AnyOf(filters ...*Filter) *Filter {
+	return &Filter{operator: LO_OR, filters: filters}
+}
+
+// Not returns a filter passing the rows which do not pass filter
+func Not(filter *Filter) *Filter {
+	return &Filter{operator: LO_NOT, filters: []*Filter{filter}}
+}
+
+// LatestVersionOnly sets whether only the latest version of the column is compared, it is true by default.
+// it is applied to the conditions of a composite filter which do not set it
+func (f *Filter) LatestVersionOnly(b bool) *Filter {
+	f.latestVersionOnly = &b
+	return f
+}
+
+// FilterIfMissing sets whether a row without the column is filtered out, it is false by default.
+// it is applied to the conditions of a composite filter which do not set it
+func (f *Filter) FilterIfMissing(b bool) *Filter {
+	f.filterIfMissing = &b
+	return f
+}
+
+// build returns the sdk filter for the struct of s, latestVersionOnly and filterIfMissing are inherited from
+// the composite filter containing f
+func (f *Filter) build(s *schema, latestVersionOnly, filterIfMissing bool) (ColumnFilter, error) {
+	if f.latestVersionOnly != nil {
+		latestVersionOnly = *f.latestVersionOnly
+	}
+	if f.filterIfMissing != nil {
+		filterIfMissing = *f.filterIfMissing
+	}
+	if f.operator != 0 {
+		if len(f.filters) == 0 || f.operator == LO_NOT && len(f.filters) != 1 {
+			return nil, fmt.Errorf("simple-tablestore: invalid filter of %s: composite filter has %d filters", s.typ, len(f.filters))
+		}
+		composite := NewCompositeColumnCondition(f.operator)
+		for _, sub := range f.filters {
+			filter, err := sub.build(s, latestVersionOnly, filterIfMissing)
+			if err != nil {
+				return nil, err
+			}
+			composite.AddFilter(filter)
+		}
+		return composite, nil
+	}
+
+	var field *schemaField
+	for _, sf := range s.cols {
+		if sf.name == f.field && !sf.isPrefixCol {
+			field = sf
+		}
+	}
+	if field == nil {
+		return nil, fmt.Errorf("simple-tablestore: invalid filter of %s: %s is not a field with ts_col tag", s.typ, f.field)
+	}
+	value := getSupportedValue(f.value)
+	if value == nil {
+		return nil, fmt.Errorf("simple-tablestore: invalid filter of %s: value %v(%T) of %s is not supported", s.typ, f.value, f.value, f.field)
+	}
+	cond := NewSingleColumnCondition(field.fieldName, f.comparator, value)
+	cond.LatestVersionOnly = latestVersionOnly
+	cond.FilterIfMissing = filterIfMissing
+	return cond, nil
+}
+
+// columnFilterOf returns the column filter of options for the struct of s, FilterOption takes precedence over
+// ColumnFilterOption
+func (o *Options) columnFilterOf(s *schema) (ColumnFilter, error) {
+	if o.filter == nil {
+		return o.columnFilter, nil
+	}
+	return o.filter.build(s, true, false)
+}
@@ -1,10 +1,16 @@
 module git.yixindev.net/common/simple-tablestore
 
-
-go 1.14
+go 1.18
 
 require (
 	github.com/aliyun/aliyun-tablestore-go-sdk v1.5.0
-	github.com/golang/protobuf v1.4.2 // indirect
+	github.com/golang/protobuf v1.4.2
 	github.com/stretchr/testify v1.4.0
 )
+
+require (
+	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	google.golang.org/protobuf v1.23.0 // indirect
+	gopkg.in/yaml.v2 v2.2.2 // indirect
+)
@@ -0,0 +1,330 @@
+package memts
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	. "github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/otsprotocol"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/search"
+	"github.com/golang/protobuf/proto"
+)
+
+const defaultGroupBySize = 10
+
+// aggField returns the schema of a field which can be aggregated
+func (e *evaluator) aggField(name string, numeric bool) (*FieldSchema, error) {
+	fs, err := e.field(name)
+	if err != nil {
+		return nil, err
+	}
+	if fs.EnableSortAndAgg == nil || !*fs.EnableSortAndAgg {
+		return nil, fmt.Errorf("field %s does not enable sort and agg", name)
+	}
+	if numeric && fs.FieldType != FieldType_LONG && fs.FieldType != FieldType_DOUBLE {
+		return nil, fmt.Errorf("field %s must be long or double", name)
+	}
+	return fs, nil
+}
+
+// aggValues returns the values of field in rows, missing is used for a row without value if it is not empty
+func (e *evaluator) aggValues(rows []*row, fs *FieldSchema, missing []byte) ([]interface{}, error) {
+	var missingValue interface{}
+	if len(missing) > 0 {
+		var err error
+		if missingValue, err = decodeVariant(missing); err != nil {
+			return nil, err
+		}
+	}
+	var values []interface{}
+	for _, r := range rows {
+		vs := e.values(r, fs)
+		if len(vs) == 0 && missingValue != nil {
+			vs = []interface{}{missingValue}
+		}
+		values = append(values, vs...)
+	}
+	return values, nil
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// aggregate computes count, distinct count, sum, avg, min and max aggregations over rows
+func (e *evaluator) aggregate(rows []*row, aggs []*otsprotocol.Aggregation) (search.AggregationResults, error) {
+	var results search.AggregationResults
+	for _, agg := range aggs {
+		name := agg.GetName()
+		var missing []byte
+		var body interface {
+			proto.Message
+			GetFieldName() string
+		}
+		switch agg.GetType() {
+		case otsprotocol.AggregationType_AGG_COUNT:
+			body = new(otsprotocol.CountAggregation)
+		case otsprotocol.AggregationType_AGG_DISTINCT_COUNT:
+			body = new(otsprotocol.DistinctCountAggregation)
+		case otsprotocol.AggregationType_AGG_SUM:
+			body = new(otsprotocol.SumAggregation)
+		case otsprotocol.AggregationType_AGG_AVG:
+			body = new(otsprotocol.AvgAggregation)
+		case otsprotocol.AggregationType_AGG_MIN:
+			body = new(otsprotocol.MinAggregation)
+		case otsprotocol.AggregationType_AGG_MAX:
+			body = new(otsprotocol.MaxAggregation)
+		default:
+			return results, fmt.Errorf("aggregation type %s is not supported by memts", agg.GetType())
+		}
+		if err := proto.Unmarshal(agg.Body, body); err != nil {
+			return results, err
+		}
+		if m, ok := body.(interface{ GetMissing() []byte }); ok {
+			missing = m.GetMissing()
+		}
+		numeric := agg.GetType() != otsprotocol.AggregationType_AGG_COUNT && agg.GetType() != otsprotocol.AggregationType_AGG_DISTINCT_COUNT
+		fs, err := e.aggField(body.GetFieldName(), numeric)
+		if err != nil {
+			return results, err
+		}
+		values, err := e.aggValues(rows, fs, missing)
+		if err != nil {
+			return results, err
+		}
+
+		switch agg.GetType() {
+		case otsprotocol.AggregationType_AGG_COUNT:
+			results.Put(name, &search.CountAggregationResult{Name: name, Value: int64(len(values))})
+		case otsprotocol.AggregationType_AGG_DISTINCT_COUNT:
+			distinct := make(map[interface{}]bool)
+			for _, v := range values {
+				distinct[v] = true
+			}
+			results.Put(name, &search.DistinctCountAggregationResult{Name: name, Value: int64(len(distinct))})
+		default:
+			sum, min, max := 0.0, math.Inf(1), math.Inf(-1)
+			for _, v := range values {
+				f, _ := toFloat(v)
+				sum += f
+				min = math.Min(min, f)
+				max = math.Max(max, f)
+			}
+			switch agg.GetType() {
+			case otsprotocol.AggregationType_AGG_SUM:
+				results.Put(name, &search.SumAggregationResult{Name: name, Value: sum})
+			case otsprotocol.AggregationType_AGG_AVG:
+				avg := math.Inf(1)
+				if len(values) > 0 {
+					avg = sum / float64(len(values))
+				}
+				results.Put(name, &search.AvgAggregationResult{Name: name, Value: avg})
+			case otsprotocol.AggregationType_AGG_MIN:
+				results.Put(name, &search.MinAggregationResult{Name: name, Value: min})
+			case otsprotocol.AggregationType_AGG_MAX:
+				results.Put(name, &search.MaxAggregationResult{Name: name, Value: max})
+			}
+		}
+	}
+	return results, nil
+}
+
+// subResults computes the sub aggregations and group bys of a bucket
+func (e *evaluator) subResults(rows []*row, aggs *otsprotocol.Aggregations, groupBys *otsprotocol.GroupBys) (search.AggregationResults, search.GroupByResults, error) {
+	aggResults, err := e.aggregate(rows, aggs.GetAggs())
+	if err != nil {
+		return aggResults, search.GroupByResults{}, err
+	}
+	groupByResults, err := e.groupBy(rows, groupBys.GetGroupBys())
+	return aggResults, groupByResults, err
+}
+
+// groupBy computes group by field, range and filter over rows
+func (e *evaluator) groupBy(rows []*row, groupBys []*otsprotocol.GroupBy) (search.GroupByResults, error) {
+	var results search.GroupByResults
+	for _, groupBy := range groupBys {
+		name := groupBy.GetName()
+		switch groupBy.GetType() {
+		case otsprotocol.GroupByType_GROUP_BY_FIELD:
+			m := new(otsprotocol.GroupByField)
+			if err := proto.Unmarshal(groupBy.Body, m); err != nil {
+				return results, err
+			}
+			result, err := e.groupByField(name, rows, m)
+			if err != nil {
+				return results, err
+			}
+			results.Put(name, result)
+		case otsprotocol.GroupByType_GROUP_BY_RANGE:
+			m := new(otsprotocol.GroupByRange)
+			if err := proto.Unmarshal(groupBy.Body, m); err != nil {
+				return results, err
+			}
+			fs, err := e.aggField(m.GetFieldName(), true)
+			if err != nil {
+				return results, err
+			}
+			result := &search.GroupByRangeResult{Name: name}
+			for _, r := range m.Ranges {
+				from, to := math.Inf(-1), math.Inf(1)
+				if r.From != nil {
+					from = r.GetFrom()
+				}
+				if r.To != nil {
+					to = r.GetTo()
+				}
+				var bucket []*row
+				for _, row := range rows {
+					for _, v := range e.values(row, fs) {
+						if f, _ := toFloat(v); f >= from && f < to {
+							bucket = append(bucket, row)
+							break
+						}
+					}
+				}
+				item := search.GroupByRangeResultItem{From: from, To: to, RowCount: int64(len(bucket))}
+				if item.SubAggregations, item.SubGroupBys, err = e.subResults(bucket, m.SubAggs, m.SubGroupBys); err != nil {
+					return results, err
+				}
+				result.Items = append(result.Items, item)
+			}
+			results.Put(name, result)
+		case otsprotocol.GroupByType_GROUP_BY_FILTER:
+			m := new(otsprotocol.GroupByFilter)
+			if err := proto.Unmarshal(groupBy.Body, m); err != nil {
+				return results, err
+			}
+			result := &search.GroupByFilterResult{Name: name}
+			for _, filter := range m.Filters {
+				match, err := e.compile(filter)
+				if err != nil {
+					return results, err
+				}
+				var bucket []*row
+				for _, r := range rows {
+					if match(r) {
+						bucket = append(bucket, r)
+					}
+				}
+				item := search.GroupByFilterResultItem{RowCount: int64(len(bucket))}
+				if item.SubAggregations, item.SubGroupBys, err = e.subResults(bucket, m.SubAggs, m.SubGroupBys); err != nil {
+					return results, err
+				}
+				result.Items = append(result.Items, item)
+			}
+			results.Put(name, result)
+		default:
+			return results, fmt.Errorf("group by type %s is not supported by memts", groupBy.GetType())
+		}
+	}
+	return results, nil
+}
+
+// groupByField groups rows by the values of field, the groups are sorted by the row count in descending order
+// and then the key in ascending order unless sorters are given
+func (e *evaluator) groupByField(name string, rows []*row, m *otsprotocol.GroupByField) (*search.GroupByFieldResult, error) {
+	fs, err := e.aggField(m.GetFieldName(), false)
+	if err != nil {
+		return nil, err
+	}
+	type group struct {
+		value interface{}
+		rows  []*row
+	}
+	var groups []*group
+	for _, r := range rows {
+		seen := make(map[interface{}]bool)
+		for _, v := range e.values(r, fs) {
+			if seen[v] {
+				continue
+			}
+			seen[v] = true
+			var g *group
+			for _, existing := range groups {
+				if c, ok := compareValue(existing.value, v); ok && c == 0 {
+					g = existing
+					break
+				}
+			}
+			if g == nil {
+				g = &group{value: v}
+				groups = append(groups, g)
+			}
+			g.rows = append(g.rows, r)
+		}
+	}
+
+	type key struct {
+		rowCount bool
+		desc     bool
+	}
+	keys := []key{{rowCount: true, desc: true}, {}}
+	if sorters := m.GetSort().GetSorters(); len(sorters) > 0 {
+		keys = nil
+		for _, sorter := range sorters {
+			switch {
+			case sorter.GroupKeySort != nil:
+				keys = append(keys, key{desc: sorter.GroupKeySort.GetOrder() == otsprotocol.SortOrder_SORT_ORDER_DESC})
+			case sorter.RowCountSort != nil:
+				keys = append(keys, key{rowCount: true, desc: sorter.RowCountSort.GetOrder() == otsprotocol.SortOrder_SORT_ORDER_DESC})
+			default:
+				return nil, errors.New("sub aggregation sort is not supported by memts")
+			}
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		for _, k := range keys {
+			var c int
+			if k.rowCount {
+				c = len(groups[i].rows) - len(groups[j].rows)
+			} else {
+				c, _ = compareValue(groups[i].value, groups[j].value)
+			}
+			if k.desc {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+
+	size := defaultGroupBySize
+	if m.Size != nil {
+		size = int(m.GetSize())
+	}
+	if len(groups) > size {
+		groups = groups[:size]
+	}
+	result := &search.GroupByFieldResult{Name: name}
+	for _, g := range groups {
+		item := search.GroupByFieldResultItem{Key: groupKey(g.value), RowCount: int64(len(g.rows))}
+		if item.SubAggregations, item.SubGroupBys, err = e.subResults(g.rows, m.SubAggs, m.SubGroupBys); err != nil {
+			return nil, err
+		}
+		result.Items = append(result.Items, item)
+	}
+	return result, nil
+}
+
+func groupKey(v interface{}) string {
+	switch v := v.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(v)
+}
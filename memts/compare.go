@@ -0,0 +1,190 @@
+package memts
+
+import (
+	"bytes"
+	"reflect"
+
+	. "github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+)
+
+// normalizeValue converts the value into the type tablestore really stores(int64, float64, string, bool or []byte),
+// ok is false if the value can not be stored
+func normalizeValue(v interface{}) (interface{}, bool) {
+	switch x := v.(type) {
+	case int64, float64, string, bool:
+		return x, true
+	case []byte:
+		return append([]byte(nil), x...), true
+	case nil:
+		return nil, false
+	}
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int(), true
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return int64(value.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), true
+	case reflect.String:
+		return value.String(), true
+	case reflect.Bool:
+		return value.Bool(), true
+	}
+	return nil, false
+}
+
+func copyValue(v interface{}) interface{} {
+	if b, ok := v.([]byte); ok {
+		return append([]byte(nil), b...)
+	}
+	return v
+}
+
+// compareValue compares two normalized values, ok is false if they are not comparable
+func compareValue(a, b interface{}) (int, bool) {
+	switch x := a.(type) {
+	case int64:
+		y, ok := b.(int64)
+		if !ok {
+			return 0, false
+		}
+		return compareInt64(x, y), true
+	case float64:
+		y, ok := b.(float64)
+		if !ok {
+			return 0, false
+		}
+		if x < y {
+			return -1, true
+		} else if x > y {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		if x < y {
+			return -1, true
+		} else if x > y {
+			return 1, true
+		}
+		return 0, true
+	case []byte:
+		y, ok := b.([]byte)
+		if !ok {
+			return 0, false
+		}
+		return bytes.Compare(x, y), true
+	case bool:
+		y, ok := b.(bool)
+		if !ok {
+			return 0, false
+		}
+		if x == y {
+			return 0, true
+		} else if !x {
+			return -1, true
+		}
+		return 1, true
+	}
+	return 0, false
+}
+
+func compareInt64(x, y int64) int {
+	if x < y {
+		return -1
+	} else if x > y {
+		return 1
+	}
+	return 0
+}
+
+// comparePrimaryKeyColumn compares a stored primary key value with a key column which may be INF_MIN or INF_MAX
+func comparePrimaryKeyColumn(value interface{}, col *PrimaryKeyColumn) int {
+	switch col.PrimaryKeyOption {
+	case MIN:
+		return 1
+	case MAX:
+		return -1
+	}
+	c, _ := compareValue(value, col.Value)
+	return c
+}
+
+// comparePrimaryKey compares stored primary key values with a complete primary key
+func comparePrimaryKey(values []interface{}, pk []*PrimaryKeyColumn) int {
+	for i, value := range values {
+		if c := comparePrimaryKeyColumn(value, pk[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func comparePrimaryKeyValues(a, b []interface{}) int {
+	for i := range a {
+		if c, _ := compareValue(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// matchFilter evaluates the column filter against the attribute columns of a row
+func matchFilter(filter ColumnFilter, cols map[string]*column) bool {
+	switch f := filter.(type) {
+	case *SingleColumnCondition:
+		col, ok := cols[*f.ColumnName]
+		if !ok {
+			return !f.FilterIfMissing
+		}
+		expected, ok := normalizeValue(f.ColumnValue)
+		if !ok {
+			return false
+		}
+		c, ok := compareValue(col.value, expected)
+		if !ok {
+			return false
+		}
+		switch *f.Comparator {
+		case CT_EQUAL:
+			return c == 0
+		case CT_NOT_EQUAL:
+			return c != 0
+		case CT_GREATER_THAN:
+			return c > 0
+		case CT_GREATER_EQUAL:
+			return c >= 0
+		case CT_LESS_THAN:
+			return c < 0
+		case CT_LESS_EQUAL:
+			return c <= 0
+		}
+		return false
+	case *CompositeColumnValueFilter:
+		switch f.Operator {
+		case LO_NOT:
+			return len(f.Filters) == 1 && !matchFilter(f.Filters[0], cols)
+		case LO_AND:
+			for _, sub := range f.Filters {
+				if !matchFilter(sub, cols) {
+					return false
+				}
+			}
+			return true
+		case LO_OR:
+			for _, sub := range f.Filters {
+				if matchFilter(sub, cols) {
+					return true
+				}
+			}
+			return false
+		}
+		return false
+	}
+	// pagination filter and unknown filters are not evaluated
+	return true
+}
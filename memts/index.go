@@ -0,0 +1,179 @@
+package memts
+
+import (
+	"sort"
+
+	. "github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+)
+
+// CreateIndex creates a global secondary index. the index is not stored, its rows are built from the table when it
+// is read by GetRange, so it is always consistent with the table
+func (s *Store) CreateIndex(request *CreateIndexRequest) (*CreateIndexResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.table(request.MainTableName)
+	if err != nil {
+		return nil, err
+	}
+	meta := request.IndexMeta
+	if meta == nil || meta.IndexName == "" {
+		return nil, s.errParameterInvalid("index name is required")
+	}
+	if _, ok := s.tables[meta.IndexName]; ok {
+		return nil, s.newError(errCodeObjectAlreadyExist, "Requested table already exists.", 409)
+	}
+	if _, _, ok := s.index(meta.IndexName); ok {
+		return nil, s.newError(errCodeObjectAlreadyExist, "Requested index already exists.", 409)
+	}
+	if len(meta.Primarykey) == 0 {
+		return nil, s.errParameterInvalid("index %s has no primary key", meta.IndexName)
+	}
+	for _, name := range meta.Primarykey {
+		if _, ok := t.indexKeyType(name); !ok {
+			return nil, s.errParameterInvalid("column %s of index %s must be a primary key or a defined column of type INTEGER, STRING or BINARY", name, meta.IndexName)
+		}
+	}
+	for _, name := range meta.DefinedColumns {
+		if !t.isDefinedColumn(name) {
+			return nil, s.errParameterInvalid("column %s of index %s is not a defined column", name, meta.IndexName)
+		}
+	}
+	t.indexes = append(t.indexes, &IndexMeta{
+		IndexName:      meta.IndexName,
+		Primarykey:     append([]string(nil), meta.Primarykey...),
+		DefinedColumns: append([]string(nil), meta.DefinedColumns...),
+		IndexType:      meta.IndexType,
+	})
+	return &CreateIndexResponse{ResponseInfo: s.responseInfo()}, nil
+}
+
+func (s *Store) DeleteIndex(request *DeleteIndexRequest) (*DeleteIndexResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.table(request.MainTableName)
+	if err != nil {
+		return nil, err
+	}
+	for i, meta := range t.indexes {
+		if meta.IndexName == request.IndexName {
+			t.indexes = append(t.indexes[:i], t.indexes[i+1:]...)
+			return &DeleteIndexResponse{ResponseInfo: s.responseInfo()}, nil
+		}
+	}
+	return nil, s.newError(errCodeObjectNotExist, "Requested index does not exist.", 404)
+}
+
+// index returns the table and meta of index
+func (s *Store) index(name string) (*table, *IndexMeta, bool) {
+	for _, t := range s.tables {
+		for _, meta := range t.indexes {
+			if meta.IndexName == name {
+				return t, meta, true
+			}
+		}
+	}
+	return nil, nil, false
+}
+
+// readTable returns the table, or the rows of index built from its table if name is an index
+func (s *Store) readTable(name string) (*table, error) {
+	if t, ok := s.tables[name]; ok {
+		return t, nil
+	}
+	if t, meta, ok := s.index(name); ok {
+		return t.buildIndex(meta), nil
+	}
+	return nil, s.errTableNotExist()
+}
+
+func (t *table) isDefinedColumn(name string) bool {
+	for _, col := range t.meta.DefinedColumns {
+		if col.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// indexKeyType returns the type of a primary key or a defined column which can be a primary key of index
+func (t *table) indexKeyType(name string) (PrimaryKeyType, bool) {
+	for _, schema := range t.meta.SchemaEntry {
+		if *schema.Name == name {
+			return *schema.Type, true
+		}
+	}
+	for _, col := range t.meta.DefinedColumns {
+		if col.Name != name {
+			continue
+		}
+		switch col.ColumnType {
+		case DefinedColumn_INTEGER:
+			return PrimaryKeyType_INTEGER, true
+		case DefinedColumn_STRING:
+			return PrimaryKeyType_STRING, true
+		case DefinedColumn_BINARY:
+			return PrimaryKeyType_BINARY, true
+		}
+	}
+	return 0, false
+}
+
+// buildIndex returns the index as a table, its primary keys are the columns of index followed by the primary keys of
+// table which are not columns of index, rows missing any column of index or having a value of other type are skipped
+func (t *table) buildIndex(meta *IndexMeta) *table {
+	index := &table{meta: &TableMeta{TableName: meta.IndexName}}
+	// position of the primary key in table, or -1 if it is an attribute column
+	var positions []int
+	addKey := func(name string) {
+		pkType, _ := t.indexKeyType(name)
+		index.meta.AddPrimaryKeyColumn(name, pkType)
+		position := -1
+		for i, schema := range t.meta.SchemaEntry {
+			if *schema.Name == name {
+				position = i
+			}
+		}
+		positions = append(positions, position)
+	}
+	for _, name := range meta.Primarykey {
+		addKey(name)
+	}
+	for _, schema := range t.meta.SchemaEntry {
+		found := false
+		for _, name := range meta.Primarykey {
+			found = found || name == *schema.Name
+		}
+		if !found {
+			addKey(*schema.Name)
+		}
+	}
+
+	for _, r := range t.rows {
+		ir := &row{cols: make(map[string]*column)}
+		for i, position := range positions {
+			if position >= 0 {
+				ir.pk = append(ir.pk, r.pk[position])
+				continue
+			}
+			col, ok := r.cols[*index.meta.SchemaEntry[i].Name]
+			if !ok || !primaryKeyTypeMatch(*index.meta.SchemaEntry[i].Type, col.value) {
+				ir = nil
+				break
+			}
+			ir.pk = append(ir.pk, col.value)
+		}
+		if ir == nil {
+			continue
+		}
+		for _, name := range meta.DefinedColumns {
+			if col, ok := r.cols[name]; ok {
+				ir.cols[name] = col
+			}
+		}
+		index.rows = append(index.rows, ir)
+	}
+	sort.Slice(index.rows, func(i, j int) bool {
+		return comparePrimaryKeyValues(index.rows[i].pk, index.rows[j].pk) < 0
+	})
+	return index
+}
@@ -0,0 +1,329 @@
+// Package memts is an in-memory emulator of tablestore, it implements the table and row apis used by simplets
+// so that code built on simplets can be tested without any network access or credentials.
+//
+// It emulates primary key ordering, auto increment primary keys, row existence expectations, column conditions,
+// atomic increments, GetRange pagination, split points, GetRange over global secondary indexes and the common
+// search index queries, but it does not emulate multiple versions, ttl or throughput limits.
+package memts
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	. "github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+)
+
+const (
+	errCodeObjectNotExist      = "OTSObjectNotExist"
+	errCodeObjectAlreadyExist  = "OTSObjectAlreadyExist"
+	errCodeConditionCheckFail  = "OTSConditionCheckFail"
+	errCodeParameterInvalid    = "OTSParameterInvalid"
+	errMessageTableNotExist    = "Requested table does not exist."
+	errMessageConditionFail    = "Condition check failed."
+	maxRowsPerBatchGet         = 100
+	maxRowsPerBatchWrite       = 200
+	maxRowsPerGetRange         = 5000
+	defaultReservedReadWriteCU = 0
+	defaultSplitSizeUnit       = 100 << 20
+)
+
+// Store is an in-memory tablestore instance, it is safe for concurrent use
+type Store struct {
+	mu        sync.Mutex
+	tables    map[string]*table
+	requestID int64
+
+	batchWriteRowHook func(change RowChange) error
+	splitSizeUnit     int64
+}
+
+type table struct {
+	meta          *TableMeta
+	option        *TableOption
+	throughput    *ReservedThroughput
+	stream        *StreamSpecification
+	indexes       []*IndexMeta
+	searchIndexes []*searchIndex
+	rows          []*row // sorted by primary key
+	lastAutoInc   int64
+}
+
+// New returns an empty Store
+func New() *Store {
+	return &Store{tables: make(map[string]*table), splitSizeUnit: defaultSplitSizeUnit}
+}
+
+// SetBatchWriteRowHook sets a hook called for every row of BatchWriteRow before it is written,
+// the row fails with the error returned by hook if it is not nil, use an *OtsError to control the error code.
+// it is useful to emulate throttling and other partial failures in tests
+func (s *Store) SetBatchWriteRowHook(hook func(change RowChange) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batchWriteRowHook = hook
+}
+
+// SetSplitSizeUnit sets the bytes of a unit of SplitSize of ComputeSplitPointsBySize, it is 100MB by default
+// like tablestore, a small unit splits small tables in tests
+func (s *Store) SetSplitSizeUnit(bytes int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.splitSizeUnit = bytes
+}
+
+func (s *Store) newError(code, message string, httpStatus int) error {
+	s.requestID++
+	return &OtsError{
+		Code:           code,
+		Message:        message,
+		RequestId:      fmt.Sprintf("memts-%08d", s.requestID),
+		HttpStatusCode: httpStatus,
+	}
+}
+
+func (s *Store) errTableNotExist() error {
+	return s.newError(errCodeObjectNotExist, errMessageTableNotExist, 404)
+}
+
+func (s *Store) errConditionCheckFail() error {
+	return s.newError(errCodeConditionCheckFail, errMessageConditionFail, 403)
+}
+
+func (s *Store) errParameterInvalid(format string, args ...interface{}) error {
+	return s.newError(errCodeParameterInvalid, fmt.Sprintf(format, args...), 400)
+}
+
+func (s *Store) responseInfo() ResponseInfo {
+	s.requestID++
+	return ResponseInfo{RequestId: fmt.Sprintf("memts-%08d", s.requestID)}
+}
+
+func (s *Store) CreateTable(request *CreateTableRequest) (*CreateTableResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if request.TableMeta == nil || request.TableMeta.TableName == "" {
+		return nil, s.errParameterInvalid("table name is required")
+	}
+	name := request.TableMeta.TableName
+	if _, ok := s.tables[name]; ok {
+		return nil, s.newError(errCodeObjectAlreadyExist, "Requested table already exists.", 409)
+	}
+	if len(request.TableMeta.SchemaEntry) == 0 || len(request.TableMeta.SchemaEntry) > 4 {
+		return nil, s.errParameterInvalid("the number of primary key columns must be in range: [1, 4]")
+	}
+	for i, schema := range request.TableMeta.SchemaEntry {
+		if schema.Name == nil || schema.Type == nil {
+			return nil, s.errParameterInvalid("primary key schema at %d is incomplete", i)
+		}
+		if schema.Option != nil && *schema.Option == AUTO_INCREMENT {
+			if i == 0 {
+				return nil, s.errParameterInvalid("the first primary key can not be auto increment")
+			}
+			if *schema.Type != PrimaryKeyType_INTEGER {
+				return nil, s.errParameterInvalid("auto increment primary key %s must be integer", *schema.Name)
+			}
+		}
+	}
+	t := &table{
+		meta:       copyTableMeta(request.TableMeta),
+		option:     &TableOption{TimeToAlive: -1, MaxVersion: 1},
+		throughput: &ReservedThroughput{Readcap: defaultReservedReadWriteCU, Writecap: defaultReservedReadWriteCU},
+		stream:     request.StreamSpec,
+		indexes:    request.IndexMetas,
+	}
+	if request.TableOption != nil {
+		option := *request.TableOption
+		t.option = &option
+	}
+	if request.ReservedThroughput != nil {
+		throughput := *request.ReservedThroughput
+		t.throughput = &throughput
+	}
+	s.tables[name] = t
+	return &CreateTableResponse{ResponseInfo: s.responseInfo()}, nil
+}
+
+func (s *Store) DescribeTable(request *DescribeTableRequest) (*DescribeTableResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tables[request.TableName]
+	if !ok {
+		return &DescribeTableResponse{}, s.errTableNotExist()
+	}
+	option := *t.option
+	throughput := *t.throughput
+	resp := &DescribeTableResponse{
+		TableMeta:          copyTableMeta(t.meta),
+		TableOption:        &option,
+		ReservedThroughput: &throughput,
+		StreamDetails:      &StreamDetails{EnableStream: false},
+		IndexMetas:         append([]*IndexMeta(nil), t.indexes...),
+		ResponseInfo:       s.responseInfo(),
+	}
+	if t.stream != nil && t.stream.EnableStream {
+		resp.StreamDetails = &StreamDetails{EnableStream: true, ExpirationTime: t.stream.ExpirationTime}
+	}
+	return resp, nil
+}
+
+func (s *Store) UpdateTable(request *UpdateTableRequest) (*UpdateTableResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tables[request.TableName]
+	if !ok {
+		return nil, s.errTableNotExist()
+	}
+	if request.TableOption != nil {
+		option := *request.TableOption
+		if option.DeviationCellVersionInSec <= 0 {
+			option.DeviationCellVersionInSec = t.option.DeviationCellVersionInSec
+		}
+		t.option = &option
+	}
+	if request.ReservedThroughput != nil {
+		throughput := *request.ReservedThroughput
+		t.throughput = &throughput
+	}
+	if request.StreamSpec != nil {
+		stream := *request.StreamSpec
+		t.stream = &stream
+	}
+	option := *t.option
+	throughput := *t.throughput
+	resp := &UpdateTableResponse{
+		TableOption:        &option,
+		ReservedThroughput: &throughput,
+		StreamDetails:      &StreamDetails{EnableStream: false},
+		ResponseInfo:       s.responseInfo(),
+	}
+	if t.stream != nil && t.stream.EnableStream {
+		resp.StreamDetails = &StreamDetails{EnableStream: true, ExpirationTime: t.stream.ExpirationTime}
+	}
+	return resp, nil
+}
+
+func (s *Store) AddDefinedColumn(request *AddDefinedColumnRequest) (*AddDefinedColumnResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tables[request.TableName]
+	if !ok {
+		return nil, s.errTableNotExist()
+	}
+	for _, col := range request.DefinedColumns {
+		for _, pk := range t.meta.SchemaEntry {
+			if *pk.Name == col.Name {
+				return nil, s.errParameterInvalid("defined column %s conflicts with primary key", col.Name)
+			}
+		}
+		for _, defined := range t.meta.DefinedColumns {
+			if defined.Name == col.Name {
+				return nil, s.errParameterInvalid("defined column %s already exists", col.Name)
+			}
+		}
+	}
+	for _, col := range request.DefinedColumns {
+		t.meta.DefinedColumns = append(t.meta.DefinedColumns, &DefinedColumnSchema{Name: col.Name, ColumnType: col.ColumnType})
+	}
+	return &AddDefinedColumnResponse{ResponseInfo: s.responseInfo()}, nil
+}
+
+func (s *Store) DeleteDefinedColumn(request *DeleteDefinedColumnRequest) (*DeleteDefinedColumnResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tables[request.TableName]
+	if !ok {
+		return nil, s.errTableNotExist()
+	}
+	for _, name := range request.DefinedColumns {
+		for i, defined := range t.meta.DefinedColumns {
+			if defined.Name == name {
+				t.meta.DefinedColumns = append(t.meta.DefinedColumns[:i], t.meta.DefinedColumns[i+1:]...)
+				break
+			}
+		}
+	}
+	return &DeleteDefinedColumnResponse{ResponseInfo: s.responseInfo()}, nil
+}
+
+func (s *Store) DeleteTable(request *DeleteTableRequest) (*DeleteTableResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tables[request.TableName]; !ok {
+		return nil, s.errTableNotExist()
+	}
+	delete(s.tables, request.TableName)
+	return &DeleteTableResponse{ResponseInfo: s.responseInfo()}, nil
+}
+
+func (s *Store) ListTable() (*ListTableResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp := &ListTableResponse{ResponseInfo: s.responseInfo()}
+	for name := range s.tables {
+		resp.TableNames = append(resp.TableNames, name)
+	}
+	sort.Strings(resp.TableNames)
+	return resp, nil
+}
+
+// ComputeSplitPointsBySize splits the table by the first primary key into splits of about SplitSize units,
+// rows are sized like for the consumed capacity units
+func (s *Store) ComputeSplitPointsBySize(request *ComputeSplitPointsBySizeRequest) (*ComputeSplitPointsBySizeResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tables[request.TableName]
+	if !ok {
+		return nil, s.errTableNotExist()
+	}
+	if request.SplitSize <= 0 {
+		return nil, s.errParameterInvalid("split size must be positive")
+	}
+	resp := &ComputeSplitPointsBySizeResponse{SchemaEntry: copyTableMeta(t.meta).SchemaEntry, ResponseInfo: s.responseInfo()}
+	bound := func(first interface{}, option PrimaryKeyOption) *PrimaryKey {
+		pk := &PrimaryKey{}
+		for i, schema := range t.meta.SchemaEntry {
+			switch {
+			case i == 0 && option == NONE:
+				pk.AddPrimaryKeyColumn(*schema.Name, copyValue(first))
+			case option == MAX:
+				pk.AddPrimaryKeyColumnWithMaxValue(*schema.Name)
+			default:
+				pk.AddPrimaryKeyColumnWithMinValue(*schema.Name)
+			}
+		}
+		return pk
+	}
+	lower := bound(nil, MIN)
+	limit := request.SplitSize * s.splitSizeUnit
+	var size int64
+	for i, r := range t.rows {
+		if size >= limit {
+			if c, _ := compareValue(r.pk[0], t.rows[i-1].pk[0]); c != 0 {
+				upper := bound(r.pk[0], NONE)
+				resp.Splits = append(resp.Splits, &Split{LowerBound: lower, UpperBound: upper, Location: "memts"})
+				lower, size = upper, 0
+			}
+		}
+		size += int64(r.size())
+	}
+	resp.Splits = append(resp.Splits, &Split{LowerBound: lower, UpperBound: bound(nil, MAX), Location: "memts"})
+	return resp, nil
+}
+
+func copyTableMeta(meta *TableMeta) *TableMeta {
+	m := &TableMeta{TableName: meta.TableName}
+	for _, schema := range meta.SchemaEntry {
+		name := *schema.Name
+		pkType := *schema.Type
+		entry := &PrimaryKeySchema{Name: &name, Type: &pkType}
+		if schema.Option != nil {
+			option := *schema.Option
+			entry.Option = &option
+		}
+		m.SchemaEntry = append(m.SchemaEntry, entry)
+	}
+	for _, col := range meta.DefinedColumns {
+		m.DefinedColumns = append(m.DefinedColumns, &DefinedColumnSchema{Name: col.Name, ColumnType: col.ColumnType})
+	}
+	return m
+}
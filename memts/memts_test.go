@@ -0,0 +1,104 @@
+package memts
+
+import (
+	"testing"
+
+	. "github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/stretchr/testify/require"
+)
+
+func createTestTable(t *testing.T, s *Store) {
+	meta := &TableMeta{TableName: "test"}
+	meta.AddPrimaryKeyColumn("pk1", PrimaryKeyType_STRING)
+	meta.AddPrimaryKeyColumn("pk2", PrimaryKeyType_INTEGER)
+	_, err := s.CreateTable(&CreateTableRequest{TableMeta: meta})
+	require.NoError(t, err)
+}
+
+func putTestRow(t *testing.T, s *Store, pk1 string, pk2 int64, expect RowExistenceExpectation) error {
+	change := &PutRowChange{TableName: "test", PrimaryKey: &PrimaryKey{}}
+	change.PrimaryKey.AddPrimaryKeyColumn("pk1", pk1)
+	change.PrimaryKey.AddPrimaryKeyColumn("pk2", pk2)
+	change.AddColumn("col", pk2)
+	change.SetCondition(expect)
+	_, err := s.PutRow(&PutRowRequest{PutRowChange: change})
+	return err
+}
+
+func TestRowExistence(t *testing.T) {
+	s := New()
+	createTestTable(t, s)
+	require.NoError(t, putTestRow(t, s, "a", 1, RowExistenceExpectation_EXPECT_NOT_EXIST))
+	err := putTestRow(t, s, "a", 1, RowExistenceExpectation_EXPECT_NOT_EXIST)
+	require.Error(t, err)
+	require.Equal(t, errCodeConditionCheckFail, err.(*OtsError).Code)
+	require.NoError(t, putTestRow(t, s, "a", 1, RowExistenceExpectation_EXPECT_EXIST))
+}
+
+func TestGetRangeOrderAndPagination(t *testing.T) {
+	s := New()
+	createTestTable(t, s)
+	for _, pk1 := range []string{"b", "a", "c"} {
+		for pk2 := int64(3); pk2 > 0; pk2-- {
+			require.NoError(t, putTestRow(t, s, pk1, pk2, RowExistenceExpectation_IGNORE))
+		}
+	}
+
+	scan := func(direction Direction, start, end *PrimaryKey) []string {
+		var got []string
+		for start != nil {
+			resp, err := s.GetRange(&GetRangeRequest{RangeRowQueryCriteria: &RangeRowQueryCriteria{
+				TableName:       "test",
+				StartPrimaryKey: start,
+				EndPrimaryKey:   end,
+				Direction:       direction,
+				MaxVersion:      1,
+				Limit:           2,
+			}})
+			require.NoError(t, err)
+			for _, row := range resp.Rows {
+				got = append(got, row.PrimaryKey.PrimaryKeys[0].Value.(string)+string(rune('0'+row.PrimaryKey.PrimaryKeys[1].Value.(int64))))
+			}
+			start = resp.NextStartPrimaryKey
+		}
+		return got
+	}
+
+	start, end := &PrimaryKey{}, &PrimaryKey{}
+	start.AddPrimaryKeyColumn("pk1", "b")
+	start.AddPrimaryKeyColumnWithMinValue("pk2")
+	end.AddPrimaryKeyColumn("pk1", "c")
+	end.AddPrimaryKeyColumn("pk2", int64(2))
+	require.Equal(t, []string{"b1", "b2", "b3", "c1"}, scan(FORWARD, start, end))
+
+	start, end = &PrimaryKey{}, &PrimaryKey{}
+	start.AddPrimaryKeyColumnWithMaxValue("pk1")
+	start.AddPrimaryKeyColumnWithMaxValue("pk2")
+	end.AddPrimaryKeyColumn("pk1", "a")
+	end.AddPrimaryKeyColumn("pk2", int64(2))
+	require.Equal(t, []string{"c3", "c2", "c1", "b3", "b2", "b1", "a3"}, scan(BACKWARD, start, end))
+}
+
+func TestComputeSplitPointsBySize(t *testing.T) {
+	s := New()
+	createTestTable(t, s)
+	for _, pk1 := range []string{"a", "b", "c"} {
+		for pk2 := int64(1); pk2 <= 3; pk2++ {
+			require.NoError(t, putTestRow(t, s, pk1, pk2, RowExistenceExpectation_IGNORE))
+		}
+	}
+	resp, err := s.ComputeSplitPointsBySize(&ComputeSplitPointsBySizeRequest{TableName: "test", SplitSize: 1})
+	require.NoError(t, err)
+	require.Len(t, resp.Splits, 1)
+
+	// every row is 20 bytes, a split of 30 bytes ends at the next first primary key after 2 rows
+	s.SetSplitSizeUnit(30)
+	resp, err = s.ComputeSplitPointsBySize(&ComputeSplitPointsBySizeRequest{TableName: "test", SplitSize: 1})
+	require.NoError(t, err)
+	require.Len(t, resp.Splits, 3)
+	require.Equal(t, MIN, resp.Splits[0].LowerBound.PrimaryKeys[0].PrimaryKeyOption)
+	require.Equal(t, "b", resp.Splits[0].UpperBound.PrimaryKeys[0].Value)
+	require.Equal(t, MIN, resp.Splits[0].UpperBound.PrimaryKeys[1].PrimaryKeyOption)
+	require.Equal(t, resp.Splits[0].UpperBound, resp.Splits[1].LowerBound)
+	require.Equal(t, MAX, resp.Splits[2].UpperBound.PrimaryKeys[1].PrimaryKeyOption)
+}
@@ -0,0 +1,608 @@
+package memts
+
+import (
+	"sort"
+	"time"
+
+	. "github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+)
+
+type column struct {
+	value     interface{}
+	timestamp int64
+}
+
+type row struct {
+	pk   []interface{}
+	cols map[string]*column
+}
+
+func (r *row) size() int {
+	size := 0
+	for _, v := range r.pk {
+		size += valueSize(v)
+	}
+	for name, col := range r.cols {
+		size += len(name) + valueSize(col.value)
+	}
+	return size
+}
+
+func valueSize(v interface{}) int {
+	switch x := v.(type) {
+	case string:
+		return len(x)
+	case []byte:
+		return len(x)
+	case bool:
+		return 1
+	}
+	return 8
+}
+
+// capacityUnit follows the tablestore rule: every 4KB of data consumes one capacity unit, at least one
+func capacityUnit(size int) int32 {
+	cu := int32((size + 4095) / 4096)
+	if cu == 0 {
+		return 1
+	}
+	return cu
+}
+
+func (t *table) primaryKey(values []interface{}) PrimaryKey {
+	pk := PrimaryKey{}
+	for i, schema := range t.meta.SchemaEntry {
+		pk.AddPrimaryKeyColumn(*schema.Name, copyValue(values[i]))
+	}
+	return pk
+}
+
+// search returns the position of the row with the given primary key values, found reports whether it exists
+func (t *table) search(values []interface{}) (int, bool) {
+	i := sort.Search(len(t.rows), func(i int) bool {
+		return comparePrimaryKeyValues(t.rows[i].pk, values) >= 0
+	})
+	return i, i < len(t.rows) && comparePrimaryKeyValues(t.rows[i].pk, values) == 0
+}
+
+func (t *table) get(values []interface{}) *row {
+	if i, ok := t.search(values); ok {
+		return t.rows[i]
+	}
+	return nil
+}
+
+func (t *table) set(r *row) {
+	i, ok := t.search(r.pk)
+	if ok {
+		t.rows[i] = r
+		return
+	}
+	t.rows = append(t.rows, nil)
+	copy(t.rows[i+1:], t.rows[i:])
+	t.rows[i] = r
+}
+
+func (t *table) remove(values []interface{}) {
+	if i, ok := t.search(values); ok {
+		t.rows = append(t.rows[:i], t.rows[i+1:]...)
+	}
+}
+
+func (t *table) nextAutoIncrement() int64 {
+	// like tablestore, the auto increment value is a big number that grows over time
+	next := time.Now().UnixNano() / 1000
+	if next <= t.lastAutoInc {
+		next = t.lastAutoInc + 1
+	}
+	t.lastAutoInc = next
+	return next
+}
+
+func (s *Store) table(name string) (*table, error) {
+	t, ok := s.tables[name]
+	if !ok {
+		return nil, s.errTableNotExist()
+	}
+	return t, nil
+}
+
+func primaryKeyTypeMatch(pkType PrimaryKeyType, v interface{}) bool {
+	switch v.(type) {
+	case int64:
+		return pkType == PrimaryKeyType_INTEGER
+	case string:
+		return pkType == PrimaryKeyType_STRING
+	case []byte:
+		return pkType == PrimaryKeyType_BINARY
+	}
+	return false
+}
+
+// rowKey validates the primary key of a single row operation and returns its values,
+// auto increment columns are assigned if autoInc is true
+func (s *Store) rowKey(t *table, pk *PrimaryKey, autoInc bool) ([]interface{}, error) {
+	if pk == nil || len(pk.PrimaryKeys) != len(t.meta.SchemaEntry) {
+		return nil, s.errParameterInvalid("Validate PK size fail. Input: %d, Meta: %d.", primaryKeyLen(pk), len(t.meta.SchemaEntry))
+	}
+	values := make([]interface{}, len(pk.PrimaryKeys))
+	for i, col := range pk.PrimaryKeys {
+		schema := t.meta.SchemaEntry[i]
+		if col.ColumnName != *schema.Name {
+			return nil, s.errParameterInvalid("Validate PK name fail. Input: %s, Meta: %s.", col.ColumnName, *schema.Name)
+		}
+		if col.PrimaryKeyOption == AUTO_INCREMENT {
+			if !autoInc || schema.Option == nil || *schema.Option != AUTO_INCREMENT {
+				return nil, s.errParameterInvalid("Primary key %s is not auto increment.", col.ColumnName)
+			}
+			values[i] = t.nextAutoIncrement()
+			continue
+		}
+		if col.PrimaryKeyOption != NONE {
+			return nil, s.errParameterInvalid("INF_MIN or INF_MAX is not allowed in primary key %s.", col.ColumnName)
+		}
+		v, ok := normalizeValue(col.Value)
+		if !ok || !primaryKeyTypeMatch(*schema.Type, v) {
+			return nil, s.errParameterInvalid("Validate PK type fail. Input: %T, Meta: %v.", col.Value, *schema.Type)
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// rangeKey validates the primary key bound of a range query, INF_MIN and INF_MAX are allowed
+func (s *Store) rangeKey(t *table, pk *PrimaryKey) ([]*PrimaryKeyColumn, error) {
+	if pk == nil || len(pk.PrimaryKeys) != len(t.meta.SchemaEntry) {
+		return nil, s.errParameterInvalid("Validate PK size fail. Input: %d, Meta: %d.", primaryKeyLen(pk), len(t.meta.SchemaEntry))
+	}
+	bound := make([]*PrimaryKeyColumn, len(pk.PrimaryKeys))
+	for i, col := range pk.PrimaryKeys {
+		schema := t.meta.SchemaEntry[i]
+		if col.ColumnName != *schema.Name {
+			return nil, s.errParameterInvalid("Validate PK name fail. Input: %s, Meta: %s.", col.ColumnName, *schema.Name)
+		}
+		if col.PrimaryKeyOption == MIN || col.PrimaryKeyOption == MAX {
+			bound[i] = &PrimaryKeyColumn{ColumnName: col.ColumnName, PrimaryKeyOption: col.PrimaryKeyOption}
+			continue
+		}
+		v, ok := normalizeValue(col.Value)
+		if !ok || !primaryKeyTypeMatch(*schema.Type, v) {
+			return nil, s.errParameterInvalid("Validate PK type fail. Input: %T, Meta: %v.", col.Value, *schema.Type)
+		}
+		bound[i] = &PrimaryKeyColumn{ColumnName: col.ColumnName, Value: v}
+	}
+	return bound, nil
+}
+
+func primaryKeyLen(pk *PrimaryKey) int {
+	if pk == nil {
+		return 0
+	}
+	return len(pk.PrimaryKeys)
+}
+
+func (s *Store) checkCondition(existing *row, cond *RowCondition) error {
+	if cond == nil {
+		return nil
+	}
+	switch cond.RowExistenceExpectation {
+	case RowExistenceExpectation_EXPECT_EXIST:
+		if existing == nil {
+			return s.errConditionCheckFail()
+		}
+	case RowExistenceExpectation_EXPECT_NOT_EXIST:
+		if existing != nil {
+			return s.errConditionCheckFail()
+		}
+	}
+	if cond.ColumnCondition != nil {
+		cols := map[string]*column{}
+		if existing != nil {
+			cols = existing.cols
+		}
+		if !matchFilter(cond.ColumnCondition, cols) {
+			return s.errConditionCheckFail()
+		}
+	}
+	return nil
+}
+
+// readCriteria is the common part of SingleRowQueryCriteria, MultiRowQueryCriteria and RangeRowQueryCriteria
+type readCriteria struct {
+	columnsToGet []string
+	filter       ColumnFilter
+	startColumn  *string
+	endColumn    *string
+}
+
+// read returns the primary key and columns of the row seen through the criteria, exist is false if the
+// row is missing, filtered out or none of the requested columns exists.
+// the attribute columns are limited by both columnsToGet and [startColumn, endColumn)
+func (t *table) read(r *row, criteria readCriteria) (pk PrimaryKey, cols []*AttributeColumn, exist bool) {
+	if r == nil {
+		return
+	}
+	if criteria.filter != nil && !matchFilter(criteria.filter, r.cols) {
+		return
+	}
+	var wanted map[string]bool
+	if len(criteria.columnsToGet) == 0 {
+		pk = t.primaryKey(r.pk)
+	} else {
+		wanted = make(map[string]bool, len(criteria.columnsToGet))
+		for _, name := range criteria.columnsToGet {
+			wanted[name] = true
+		}
+		for i, schema := range t.meta.SchemaEntry {
+			if wanted[*schema.Name] {
+				pk.AddPrimaryKeyColumn(*schema.Name, copyValue(r.pk[i]))
+			}
+		}
+	}
+	for _, col := range r.columns(wanted) {
+		if (criteria.startColumn == nil || col.ColumnName >= *criteria.startColumn) &&
+			(criteria.endColumn == nil || col.ColumnName < *criteria.endColumn) {
+			cols = append(cols, col)
+		}
+	}
+	return pk, cols, len(pk.PrimaryKeys) > 0 || len(cols) > 0
+}
+
+// columns returns the attribute columns sorted by name, all columns are returned if wanted is nil
+func (r *row) columns(wanted map[string]bool) []*AttributeColumn {
+	var cols []*AttributeColumn
+	for name, col := range r.cols {
+		if wanted != nil && !wanted[name] {
+			continue
+		}
+		cols = append(cols, &AttributeColumn{ColumnName: name, Value: copyValue(col.value), Timestamp: col.timestamp})
+	}
+	sort.Slice(cols, func(i, j int) bool {
+		return cols[i].ColumnName < cols[j].ColumnName
+	})
+	return cols
+}
+
+func nowMillis() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
+func (s *Store) GetRow(request *GetRowRequest) (*GetRowResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	criteria := request.SingleRowQueryCriteria
+	t, err := s.table(criteria.TableName)
+	if err != nil {
+		return nil, err
+	}
+	values, err := s.rowKey(t, criteria.PrimaryKey, false)
+	if err != nil {
+		return nil, err
+	}
+	r := t.get(values)
+	resp := &GetRowResponse{ConsumedCapacityUnit: &ConsumedCapacityUnit{Read: 1}, ResponseInfo: s.responseInfo()}
+	pk, cols, exist := t.read(r, readCriteria{
+		columnsToGet: criteria.ColumnsToGet,
+		filter:       criteria.Filter,
+		startColumn:  criteria.StartColumn,
+		endColumn:    criteria.EndColumn,
+	})
+	if exist {
+		resp.PrimaryKey = pk
+		resp.Columns = cols
+		resp.ConsumedCapacityUnit.Read = capacityUnit(r.size())
+	}
+	return resp, nil
+}
+
+func (s *Store) PutRow(request *PutRowRequest) (*PutRowResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pk, cu, err := s.putRow(request.PutRowChange)
+	if err != nil {
+		return nil, err
+	}
+	return &PutRowResponse{PrimaryKey: pk, ConsumedCapacityUnit: cu, ResponseInfo: s.responseInfo()}, nil
+}
+
+func (s *Store) putRow(change *PutRowChange) (PrimaryKey, *ConsumedCapacityUnit, error) {
+	var pk PrimaryKey
+	t, err := s.table(change.TableName)
+	if err != nil {
+		return pk, nil, err
+	}
+	values, err := s.rowKey(t, change.PrimaryKey, true)
+	if err != nil {
+		return pk, nil, err
+	}
+	existing := t.get(values)
+	if err := s.checkCondition(existing, change.Condition); err != nil {
+		return pk, nil, err
+	}
+	r := &row{pk: values, cols: make(map[string]*column, len(change.Columns))}
+	ts := nowMillis()
+	for _, col := range change.Columns {
+		v, ok := normalizeValue(col.Value)
+		if !ok {
+			return pk, nil, s.errParameterInvalid("Unsupported column type: %T.", col.Value)
+		}
+		timestamp := ts
+		if col.Timestamp != 0 {
+			timestamp = col.Timestamp
+		}
+		r.cols[col.ColumnName] = &column{value: v, timestamp: timestamp}
+	}
+	t.set(r)
+	if change.ReturnType == ReturnType_RT_PK {
+		pk = t.primaryKey(values)
+	}
+	return pk, &ConsumedCapacityUnit{Write: capacityUnit(r.size())}, nil
+}
+
+func (s *Store) UpdateRow(request *UpdateRowRequest) (*UpdateRowResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cols, cu, err := s.updateRow(request.UpdateRowChange)
+	if err != nil {
+		return nil, err
+	}
+	return &UpdateRowResponse{Columns: cols, ConsumedCapacityUnit: cu, ResponseInfo: s.responseInfo()}, nil
+}
+
+func (s *Store) updateRow(change *UpdateRowChange) ([]*AttributeColumn, *ConsumedCapacityUnit, error) {
+	t, err := s.table(change.TableName)
+	if err != nil {
+		return nil, nil, err
+	}
+	values, err := s.rowKey(t, change.PrimaryKey, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	existing := t.get(values)
+	if err := s.checkCondition(existing, change.Condition); err != nil {
+		return nil, nil, err
+	}
+	// build the new row aside, so a failed increment leaves the stored row untouched
+	r := &row{pk: values, cols: make(map[string]*column)}
+	if existing != nil {
+		for name, col := range existing.cols {
+			r.cols[name] = col
+		}
+	}
+	ts := nowMillis()
+	for _, col := range change.Columns {
+		if col.HasType && (col.Type == DELETE_ALL_VERSION || col.Type == DELETE_ONE_VERSION) {
+			delete(r.cols, col.ColumnName)
+			continue
+		}
+		v, ok := normalizeValue(col.Value)
+		if !ok {
+			return nil, nil, s.errParameterInvalid("Unsupported column type: %T.", col.Value)
+		}
+		if col.HasType && col.Type == INCREMENT {
+			delta, ok := v.(int64)
+			if !ok {
+				return nil, nil, s.errParameterInvalid("Increment value of %s must be integer.", col.ColumnName)
+			}
+			if old, exist := r.cols[col.ColumnName]; exist {
+				oldValue, ok := old.value.(int64)
+				if !ok {
+					return nil, nil, s.errParameterInvalid("Column %s to increment is not integer.", col.ColumnName)
+				}
+				delta += oldValue
+			}
+			v = delta
+		}
+		timestamp := ts
+		if col.HasTimestamp {
+			timestamp = col.Timestamp
+		}
+		r.cols[col.ColumnName] = &column{value: v, timestamp: timestamp}
+	}
+	t.set(r)
+	var cols []*AttributeColumn
+	if change.ReturnType == ReturnType_RT_AFTER_MODIFY {
+		wanted := make(map[string]bool, len(change.ColumnNamesToReturn))
+		for _, name := range change.ColumnNamesToReturn {
+			wanted[name] = true
+		}
+		cols = r.columns(wanted)
+	}
+	return cols, &ConsumedCapacityUnit{Write: capacityUnit(r.size())}, nil
+}
+
+func (s *Store) DeleteRow(request *DeleteRowRequest) (*DeleteRowResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cu, err := s.deleteRow(request.DeleteRowChange)
+	if err != nil {
+		return nil, err
+	}
+	return &DeleteRowResponse{ConsumedCapacityUnit: cu, ResponseInfo: s.responseInfo()}, nil
+}
+
+func (s *Store) deleteRow(change *DeleteRowChange) (*ConsumedCapacityUnit, error) {
+	t, err := s.table(change.TableName)
+	if err != nil {
+		return nil, err
+	}
+	values, err := s.rowKey(t, change.PrimaryKey, false)
+	if err != nil {
+		return nil, err
+	}
+	existing := t.get(values)
+	if err := s.checkCondition(existing, change.Condition); err != nil {
+		return nil, err
+	}
+	t.remove(values)
+	return &ConsumedCapacityUnit{Write: 1}, nil
+}
+
+func (s *Store) GetRange(request *GetRangeRequest) (*GetRangeResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	criteria := request.RangeRowQueryCriteria
+	t, err := s.readTable(criteria.TableName)
+	if err != nil {
+		return nil, err
+	}
+	start, err := s.rangeKey(t, criteria.StartPrimaryKey)
+	if err != nil {
+		return nil, err
+	}
+	end, err := s.rangeKey(t, criteria.EndPrimaryKey)
+	if err != nil {
+		return nil, err
+	}
+	limit := int(criteria.Limit)
+	if limit <= 0 || limit > maxRowsPerGetRange {
+		limit = maxRowsPerGetRange
+	}
+
+	// rows in range are t.rows[i] for i from first, moving by step, while inRange(i)
+	var first, step int
+	var inRange func(i int) bool
+	if criteria.Direction == BACKWARD {
+		first = sort.Search(len(t.rows), func(i int) bool {
+			return comparePrimaryKey(t.rows[i].pk, start) > 0
+		}) - 1
+		step = -1
+		inRange = func(i int) bool {
+			return i >= 0 && comparePrimaryKey(t.rows[i].pk, end) > 0
+		}
+	} else {
+		first = sort.Search(len(t.rows), func(i int) bool {
+			return comparePrimaryKey(t.rows[i].pk, start) >= 0
+		})
+		step = 1
+		inRange = func(i int) bool {
+			return i < len(t.rows) && comparePrimaryKey(t.rows[i].pk, end) < 0
+		}
+	}
+
+	resp := &GetRangeResponse{ConsumedCapacityUnit: &ConsumedCapacityUnit{}, ResponseInfo: s.responseInfo()}
+	rc := readCriteria{
+		columnsToGet: criteria.ColumnsToGet,
+		filter:       criteria.Filter,
+		startColumn:  criteria.StartColumn,
+		endColumn:    criteria.EndColumn,
+	}
+	size := 0
+	i := first
+	for ; inRange(i) && len(resp.Rows) < limit; i += step {
+		r := t.rows[i]
+		size += r.size()
+		pk, cols, exist := t.read(r, rc)
+		if !exist {
+			continue
+		}
+		resp.Rows = append(resp.Rows, &Row{PrimaryKey: &pk, Columns: cols})
+	}
+	if inRange(i) {
+		next := t.primaryKey(t.rows[i].pk)
+		resp.NextStartPrimaryKey = &next
+	}
+	resp.ConsumedCapacityUnit.Read = capacityUnit(size)
+	return resp, nil
+}
+
+func (s *Store) BatchGetRow(request *BatchGetRowRequest) (*BatchGetRowResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for _, criteria := range request.MultiRowQueryCriteria {
+		count += len(criteria.PrimaryKey)
+	}
+	if count > maxRowsPerBatchGet {
+		return nil, s.errParameterInvalid("Rows count exceeds the upper limit: %d.", maxRowsPerBatchGet)
+	}
+	resp := &BatchGetRowResponse{TableToRowsResult: make(map[string][]RowResult), ResponseInfo: s.responseInfo()}
+	for _, criteria := range request.MultiRowQueryCriteria {
+		rc := readCriteria{
+			columnsToGet: criteria.ColumnsToGet,
+			filter:       criteria.Filter,
+			startColumn:  criteria.StartColumn,
+			endColumn:    criteria.EndColumn,
+		}
+		for i, pk := range criteria.PrimaryKey {
+			result := RowResult{TableName: criteria.TableName, Index: int32(i), ConsumedCapacityUnit: &ConsumedCapacityUnit{}}
+			t, err := s.table(criteria.TableName)
+			var values []interface{}
+			if err == nil {
+				values, err = s.rowKey(t, pk, false)
+			}
+			if err != nil {
+				result.Error = rowError(err)
+			} else {
+				result.IsSucceed = true
+				result.ConsumedCapacityUnit.Read = 1
+				r := t.get(values)
+				if rowPK, cols, exist := t.read(r, rc); exist {
+					result.PrimaryKey = rowPK
+					result.Columns = cols
+					result.ConsumedCapacityUnit.Read = capacityUnit(r.size())
+				}
+			}
+			resp.TableToRowsResult[criteria.TableName] = append(resp.TableToRowsResult[criteria.TableName], result)
+		}
+	}
+	return resp, nil
+}
+
+// BatchWriteRow does not return the primary keys or the columns of the rows, like tablestore sdk v1.5.0
+func (s *Store) BatchWriteRow(request *BatchWriteRowRequest) (*BatchWriteRowResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	var tables []string
+	for name, changes := range request.RowChangesGroupByTable {
+		count += len(changes)
+		tables = append(tables, name)
+	}
+	if count > maxRowsPerBatchWrite {
+		return nil, s.errParameterInvalid("Rows count exceeds the upper limit: %d.", maxRowsPerBatchWrite)
+	}
+	sort.Strings(tables)
+	resp := &BatchWriteRowResponse{TableToRowsResult: make(map[string][]RowResult), ResponseInfo: s.responseInfo()}
+	for _, name := range tables {
+		for i, change := range request.RowChangesGroupByTable[name] {
+			result := RowResult{TableName: name, Index: int32(i), ConsumedCapacityUnit: &ConsumedCapacityUnit{}}
+			var cu *ConsumedCapacityUnit
+			var err error
+			if s.batchWriteRowHook != nil {
+				err = s.batchWriteRowHook(change)
+			}
+			switch c := change.(type) {
+			case *PutRowChange:
+				if err == nil {
+					_, cu, err = s.putRow(c)
+				}
+			case *UpdateRowChange:
+				if err == nil {
+					_, cu, err = s.updateRow(c)
+				}
+			case *DeleteRowChange:
+				if err == nil {
+					cu, err = s.deleteRow(c)
+				}
+			default:
+				err = s.errParameterInvalid("Unsupported row change: %T.", change)
+			}
+			if err != nil {
+				result.Error = rowError(err)
+			} else {
+				result.IsSucceed = true
+				result.ConsumedCapacityUnit = cu
+			}
+			resp.TableToRowsResult[name] = append(resp.TableToRowsResult[name], result)
+		}
+	}
+	return resp, nil
+}
+
+func rowError(err error) Error {
+	if e, ok := err.(*OtsError); ok {
+		return Error{Code: e.Code, Message: e.Message}
+	}
+	return Error{Code: "OTSInternalServerError", Message: err.Error()}
+}
@@ -0,0 +1,740 @@
+package memts
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	. "github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/otsprotocol"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/search"
+	"github.com/golang/protobuf/proto"
+)
+
+const (
+	defaultSearchLimit = 10
+	maxSearchLimit     = 100
+)
+
+// searchIndex is a search index of table, like secondary indexes it is evaluated against the rows of table
+// on every Search, so it is always in sync
+type searchIndex struct {
+	name   string
+	schema *IndexSchema
+	fields map[string]*FieldSchema
+}
+
+func (s *Store) CreateSearchIndex(request *CreateSearchIndexRequest) (*CreateSearchIndexResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.table(request.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if request.IndexName == "" {
+		return nil, s.errParameterInvalid("index name is required")
+	}
+	if t.searchIndex(request.IndexName) != nil {
+		return nil, s.newError(errCodeObjectAlreadyExist, "Requested index already exists.", 409)
+	}
+	if request.IndexSchema == nil || len(request.IndexSchema.FieldSchemas) == 0 {
+		return nil, s.errParameterInvalid("search index %s has no field", request.IndexName)
+	}
+	idx := &searchIndex{
+		name:   request.IndexName,
+		schema: &IndexSchema{IndexSetting: request.IndexSchema.IndexSetting, IndexSort: request.IndexSchema.IndexSort},
+		fields: make(map[string]*FieldSchema),
+	}
+	for _, fs := range request.IndexSchema.FieldSchemas {
+		if fs.FieldName == nil || *fs.FieldName == "" {
+			return nil, s.errParameterInvalid("field name of search index %s is required", request.IndexName)
+		}
+		if _, ok := idx.fields[*fs.FieldName]; ok {
+			return nil, s.errParameterInvalid("field %s of search index %s is duplicated", *fs.FieldName, request.IndexName)
+		}
+		switch fs.FieldType {
+		case FieldType_LONG, FieldType_DOUBLE, FieldType_BOOLEAN, FieldType_KEYWORD, FieldType_TEXT:
+		default:
+			return nil, s.errParameterInvalid("field type %d of %s is not supported by memts", fs.FieldType, *fs.FieldName)
+		}
+		field := *fs
+		idx.fields[*fs.FieldName] = &field
+		idx.schema.FieldSchemas = append(idx.schema.FieldSchemas, &field)
+	}
+	t.searchIndexes = append(t.searchIndexes, idx)
+	return &CreateSearchIndexResponse{ResponseInfo: s.responseInfo()}, nil
+}
+
+func (s *Store) DescribeSearchIndex(request *DescribeSearchIndexRequest) (*DescribeSearchIndexResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.table(request.TableName)
+	if err != nil {
+		return nil, err
+	}
+	idx := t.searchIndex(request.IndexName)
+	if idx == nil {
+		return nil, s.errSearchIndexNotExist()
+	}
+	schema := *idx.schema
+	schema.FieldSchemas = append([]*FieldSchema(nil), idx.schema.FieldSchemas...)
+	return &DescribeSearchIndexResponse{
+		Schema:       &schema,
+		SyncStat:     &SyncStat{SyncPhase: SyncPhase_INCR},
+		ResponseInfo: s.responseInfo(),
+	}, nil
+}
+
+func (s *Store) DeleteSearchIndex(request *DeleteSearchIndexRequest) (*DeleteSearchIndexResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.table(request.TableName)
+	if err != nil {
+		return nil, err
+	}
+	for i, idx := range t.searchIndexes {
+		if idx.name == request.IndexName {
+			t.searchIndexes = append(t.searchIndexes[:i], t.searchIndexes[i+1:]...)
+			return &DeleteSearchIndexResponse{ResponseInfo: s.responseInfo()}, nil
+		}
+	}
+	return nil, s.errSearchIndexNotExist()
+}
+
+func (s *Store) ListSearchIndex(request *ListSearchIndexRequest) (*ListSearchIndexResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.table(request.TableName)
+	if err != nil {
+		return nil, err
+	}
+	resp := &ListSearchIndexResponse{ResponseInfo: s.responseInfo()}
+	for _, idx := range t.searchIndexes {
+		resp.IndexInfo = append(resp.IndexInfo, &IndexInfo{TableName: request.TableName, IndexName: idx.name})
+	}
+	return resp, nil
+}
+
+func (s *Store) errSearchIndexNotExist() error {
+	return s.newError(errCodeObjectNotExist, "Requested index does not exist.", 404)
+}
+
+func (t *table) searchIndex(name string) *searchIndex {
+	for _, idx := range t.searchIndexes {
+		if idx.name == name {
+			return idx
+		}
+	}
+	return nil
+}
+
+// searchToken is the NextToken returned by Search, it keeps the sort because a query with token has no sort
+type searchToken struct {
+	Position int    `json:"position"`
+	Sort     []byte `json:"sort,omitempty"`
+}
+
+// Search evaluates match all, match, match phrase, term, terms, range, prefix, wildcard, exists, bool,
+// const score and function score queries, sorts by fields and primary keys, and pages by offset or token.
+// it computes count, distinct count, sum, avg, min and max aggregations and group by field, range and filter.
+// text is split into lower case words, every Han character is a word, whatever the analyzer is.
+// scores are not computed, score sort keeps the order of primary keys
+func (s *Store) Search(request *SearchRequest) (*SearchResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.table(request.TableName)
+	if err != nil {
+		return nil, err
+	}
+	idx := t.searchIndex(request.IndexName)
+	if idx == nil {
+		return nil, s.errSearchIndexNotExist()
+	}
+	if request.SearchQuery == nil {
+		return nil, s.errParameterInvalid("search query is required")
+	}
+	data, err := request.SearchQuery.Serialize()
+	if err != nil {
+		return nil, s.errParameterInvalid("%s", err)
+	}
+	query := new(otsprotocol.SearchQuery)
+	if err := proto.Unmarshal(data, query); err != nil {
+		return nil, s.errParameterInvalid("%s", err)
+	}
+
+	position := int(query.GetOffset())
+	var sortData []byte
+	if query.Sort != nil {
+		if sortData, err = proto.Marshal(query.Sort); err != nil {
+			return nil, s.errParameterInvalid("%s", err)
+		}
+	}
+	if len(query.Token) > 0 {
+		var token searchToken
+		if err := json.Unmarshal(query.Token, &token); err != nil {
+			return nil, s.errParameterInvalid("invalid token")
+		}
+		position, sortData = token.Position, token.Sort
+	}
+	pbSort := new(otsprotocol.Sort)
+	if err := proto.Unmarshal(sortData, pbSort); err != nil {
+		return nil, s.errParameterInvalid("invalid token")
+	}
+	limit := defaultSearchLimit
+	if query.Limit != nil {
+		limit = int(query.GetLimit())
+	}
+	if limit < 0 || limit > maxSearchLimit {
+		return nil, s.errParameterInvalid("limit must be in [0, %d]", maxSearchLimit)
+	}
+
+	e := &evaluator{t: t, idx: idx}
+	match := func(*row) bool { return true }
+	if query.Query != nil {
+		if match, err = e.compile(query.Query); err != nil {
+			return nil, s.errParameterInvalid("%s", err)
+		}
+	}
+	var matched []*row
+	for _, r := range t.rows {
+		if match(r) {
+			matched = append(matched, r)
+		}
+	}
+	if err := e.sort(matched, pbSort); err != nil {
+		return nil, s.errParameterInvalid("%s", err)
+	}
+
+	resp := &SearchResponse{TotalCount: -1, IsAllSuccess: true, ResponseInfo: s.responseInfo()}
+	if query.GetGetTotalCount() {
+		resp.TotalCount = int64(len(matched))
+	}
+	if resp.AggregationResults, err = e.aggregate(matched, query.GetAggs().GetAggs()); err != nil {
+		return nil, s.errParameterInvalid("%s", err)
+	}
+	if resp.GroupByResults, err = e.groupBy(matched, query.GetGroupBys().GetGroupBys()); err != nil {
+		return nil, s.errParameterInvalid("%s", err)
+	}
+	wanted := columnsToGet(request.ColumnsToGet)
+	end := position + limit
+	if end > len(matched) {
+		end = len(matched)
+	}
+	for i := position; i < end; i++ {
+		pk := t.primaryKey(matched[i].pk)
+		resp.Rows = append(resp.Rows, &Row{PrimaryKey: &pk, Columns: matched[i].columns(wanted)})
+	}
+	if limit > 0 && end < len(matched) {
+		resp.NextToken, _ = json.Marshal(searchToken{Position: end, Sort: sortData})
+	}
+	return resp, nil
+}
+
+// columnsToGet returns the wanted columns for row.columns, nil means all
+func columnsToGet(c *ColumnsToGet) map[string]bool {
+	if c != nil && c.ReturnAll {
+		return nil
+	}
+	wanted := make(map[string]bool)
+	if c != nil {
+		for _, name := range c.Columns {
+			wanted[name] = true
+		}
+	}
+	return wanted
+}
+
+type evaluator struct {
+	t   *table
+	idx *searchIndex
+}
+
+// field returns the schema of an indexed field
+func (e *evaluator) field(name string) (*FieldSchema, error) {
+	fs, ok := e.idx.fields[name]
+	if !ok {
+		return nil, fmt.Errorf("field %s is not in search index %s", name, e.idx.name)
+	}
+	return fs, nil
+}
+
+// values returns the indexed values of field in row, values of other types are not indexed
+func (e *evaluator) values(r *row, fs *FieldSchema) []interface{} {
+	var value interface{}
+	found := false
+	for i, schema := range e.t.meta.SchemaEntry {
+		if *schema.Name == *fs.FieldName {
+			value, found = r.pk[i], true
+		}
+	}
+	if col, ok := r.cols[*fs.FieldName]; ok && !found {
+		value, found = col.value, true
+	}
+	if !found {
+		return nil
+	}
+	var values []interface{}
+	if fs.IsArray != nil && *fs.IsArray {
+		str, ok := value.(string)
+		if !ok {
+			return nil
+		}
+		decoder := json.NewDecoder(strings.NewReader(str))
+		decoder.UseNumber()
+		if decoder.Decode(&values) != nil {
+			return nil
+		}
+	} else {
+		values = []interface{}{value}
+	}
+	var indexed []interface{}
+	for _, v := range values {
+		if n, ok := v.(json.Number); ok {
+			if fs.FieldType == FieldType_LONG {
+				v, _ = n.Int64()
+			} else {
+				v, _ = n.Float64()
+			}
+		}
+		switch v.(type) {
+		case int64:
+			if fs.FieldType == FieldType_LONG {
+				indexed = append(indexed, v)
+			}
+		case float64:
+			if fs.FieldType == FieldType_DOUBLE {
+				indexed = append(indexed, v)
+			}
+		case bool:
+			if fs.FieldType == FieldType_BOOLEAN {
+				indexed = append(indexed, v)
+			}
+		case string:
+			if fs.FieldType == FieldType_KEYWORD || fs.FieldType == FieldType_TEXT {
+				indexed = append(indexed, v)
+			}
+		}
+	}
+	return indexed
+}
+
+// terms returns the values to match a term, text is split into words
+func (e *evaluator) terms(r *row, fs *FieldSchema) []interface{} {
+	values := e.values(r, fs)
+	if fs.FieldType != FieldType_TEXT {
+		return values
+	}
+	var words []interface{}
+	for _, v := range values {
+		for _, w := range tokenize(v.(string)) {
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
+func tokenize(text string) []string {
+	var words []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, string(word))
+			word = word[:0]
+		}
+	}
+	for _, c := range strings.ToLower(text) {
+		switch {
+		case unicode.Is(unicode.Han, c):
+			flush()
+			words = append(words, string(c))
+		case unicode.IsLetter(c) || unicode.IsDigit(c):
+			word = append(word, c)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return words
+}
+
+type matcher func(r *row) bool
+
+func (e *evaluator) compile(q *otsprotocol.Query) (matcher, error) {
+	switch q.GetType() {
+	case otsprotocol.QueryType_MATCH_ALL_QUERY:
+		return func(*row) bool { return true }, nil
+	case otsprotocol.QueryType_TERM_QUERY:
+		m := new(otsprotocol.TermQuery)
+		if err := proto.Unmarshal(q.Query, m); err != nil {
+			return nil, err
+		}
+		term, err := decodeVariant(m.Term)
+		if err != nil {
+			return nil, err
+		}
+		return e.anyTerm(m.GetFieldName(), []interface{}{term})
+	case otsprotocol.QueryType_TERMS_QUERY:
+		m := new(otsprotocol.TermsQuery)
+		if err := proto.Unmarshal(q.Query, m); err != nil {
+			return nil, err
+		}
+		var terms []interface{}
+		for _, b := range m.Terms {
+			term, err := decodeVariant(b)
+			if err != nil {
+				return nil, err
+			}
+			terms = append(terms, term)
+		}
+		return e.anyTerm(m.GetFieldName(), terms)
+	case otsprotocol.QueryType_RANGE_QUERY:
+		m := new(otsprotocol.RangeQuery)
+		if err := proto.Unmarshal(q.Query, m); err != nil {
+			return nil, err
+		}
+		return e.rangeQuery(m)
+	case otsprotocol.QueryType_PREFIX_QUERY:
+		m := new(otsprotocol.PrefixQuery)
+		if err := proto.Unmarshal(q.Query, m); err != nil {
+			return nil, err
+		}
+		prefix := m.GetPrefix()
+		return e.anyValue(m.GetFieldName(), func(v interface{}) bool {
+			str, ok := v.(string)
+			return ok && strings.HasPrefix(str, prefix)
+		})
+	case otsprotocol.QueryType_WILDCARD_QUERY:
+		m := new(otsprotocol.WildcardQuery)
+		if err := proto.Unmarshal(q.Query, m); err != nil {
+			return nil, err
+		}
+		pattern := m.GetValue()
+		return e.anyValue(m.GetFieldName(), func(v interface{}) bool {
+			str, ok := v.(string)
+			return ok && matchWildcard(pattern, str)
+		})
+	case otsprotocol.QueryType_MATCH_QUERY:
+		m := new(otsprotocol.MatchQuery)
+		if err := proto.Unmarshal(q.Query, m); err != nil {
+			return nil, err
+		}
+		return e.matchQuery(m)
+	case otsprotocol.QueryType_MATCH_PHRASE_QUERY:
+		m := new(otsprotocol.MatchPhraseQuery)
+		if err := proto.Unmarshal(q.Query, m); err != nil {
+			return nil, err
+		}
+		return e.matchPhraseQuery(m)
+	case otsprotocol.QueryType_EXISTS_QUERY:
+		m := new(otsprotocol.ExistsQuery)
+		if err := proto.Unmarshal(q.Query, m); err != nil {
+			return nil, err
+		}
+		fs, err := e.field(m.GetFieldName())
+		if err != nil {
+			return nil, err
+		}
+		return func(r *row) bool { return len(e.values(r, fs)) > 0 }, nil
+	case otsprotocol.QueryType_BOOL_QUERY:
+		m := new(otsprotocol.BoolQuery)
+		if err := proto.Unmarshal(q.Query, m); err != nil {
+			return nil, err
+		}
+		return e.boolQuery(m)
+	case otsprotocol.QueryType_CONST_SCORE_QUERY:
+		m := new(otsprotocol.ConstScoreQuery)
+		if err := proto.Unmarshal(q.Query, m); err != nil {
+			return nil, err
+		}
+		return e.compile(m.Filter)
+	case otsprotocol.QueryType_FUNCTION_SCORE_QUERY:
+		m := new(otsprotocol.FunctionScoreQuery)
+		if err := proto.Unmarshal(q.Query, m); err != nil {
+			return nil, err
+		}
+		return e.compile(m.Query)
+	}
+	return nil, fmt.Errorf("query type %s is not supported by memts", q.GetType())
+}
+
+func (e *evaluator) anyValue(field string, match func(v interface{}) bool) (matcher, error) {
+	fs, err := e.field(field)
+	if err != nil {
+		return nil, err
+	}
+	return func(r *row) bool {
+		for _, v := range e.terms(r, fs) {
+			if match(v) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+func (e *evaluator) anyTerm(field string, terms []interface{}) (matcher, error) {
+	return e.anyValue(field, func(v interface{}) bool {
+		for _, term := range terms {
+			if c, ok := compareValue(v, term); ok && c == 0 {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (e *evaluator) rangeQuery(m *otsprotocol.RangeQuery) (matcher, error) {
+	var from, to interface{}
+	var err error
+	if len(m.RangeFrom) > 0 {
+		if from, err = decodeVariant(m.RangeFrom); err != nil {
+			return nil, err
+		}
+	}
+	if len(m.RangeTo) > 0 {
+		if to, err = decodeVariant(m.RangeTo); err != nil {
+			return nil, err
+		}
+	}
+	return e.anyValue(m.GetFieldName(), func(v interface{}) bool {
+		if from != nil {
+			c, ok := compareValue(v, from)
+			if !ok || c < 0 || (c == 0 && !m.GetIncludeLower()) {
+				return false
+			}
+		}
+		if to != nil {
+			c, ok := compareValue(v, to)
+			if !ok || c > 0 || (c == 0 && !m.GetIncludeUpper()) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func (e *evaluator) matchQuery(m *otsprotocol.MatchQuery) (matcher, error) {
+	fs, err := e.field(m.GetFieldName())
+	if err != nil {
+		return nil, err
+	}
+	if fs.FieldType != FieldType_TEXT {
+		return e.anyTerm(m.GetFieldName(), []interface{}{m.GetText()})
+	}
+	words := tokenize(m.GetText())
+	least := 1
+	if m.GetOperator() == otsprotocol.QueryOperator_AND {
+		least = len(words)
+	} else if m.MinimumShouldMatch != nil {
+		least = int(m.GetMinimumShouldMatch())
+	}
+	return func(r *row) bool {
+		terms := make(map[string]bool)
+		for _, v := range e.terms(r, fs) {
+			terms[v.(string)] = true
+		}
+		count := 0
+		for _, w := range words {
+			if terms[w] {
+				count++
+			}
+		}
+		return len(words) > 0 && count >= least
+	}, nil
+}
+
+func (e *evaluator) matchPhraseQuery(m *otsprotocol.MatchPhraseQuery) (matcher, error) {
+	fs, err := e.field(m.GetFieldName())
+	if err != nil {
+		return nil, err
+	}
+	if fs.FieldType != FieldType_TEXT {
+		return e.anyTerm(m.GetFieldName(), []interface{}{m.GetText()})
+	}
+	phrase := " " + strings.Join(tokenize(m.GetText()), " ") + " "
+	return func(r *row) bool {
+		for _, v := range e.values(r, fs) {
+			if strings.Contains(" "+strings.Join(tokenize(v.(string)), " ")+" ", phrase) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+func (e *evaluator) boolQuery(m *otsprotocol.BoolQuery) (matcher, error) {
+	compileAll := func(queries []*otsprotocol.Query) ([]matcher, error) {
+		var matchers []matcher
+		for _, q := range queries {
+			matcher, err := e.compile(q)
+			if err != nil {
+				return nil, err
+			}
+			matchers = append(matchers, matcher)
+		}
+		return matchers, nil
+	}
+	must, err := compileAll(append(m.MustQueries, m.FilterQueries...))
+	if err != nil {
+		return nil, err
+	}
+	mustNot, err := compileAll(m.MustNotQueries)
+	if err != nil {
+		return nil, err
+	}
+	should, err := compileAll(m.ShouldQueries)
+	if err != nil {
+		return nil, err
+	}
+	least := 0
+	if m.MinimumShouldMatch != nil {
+		least = int(m.GetMinimumShouldMatch())
+	} else if len(must) == 0 && len(should) > 0 {
+		least = 1
+	}
+	return func(r *row) bool {
+		for _, matcher := range must {
+			if !matcher(r) {
+				return false
+			}
+		}
+		for _, matcher := range mustNot {
+			if matcher(r) {
+				return false
+			}
+		}
+		count := 0
+		for _, matcher := range should {
+			if matcher(r) {
+				count++
+			}
+		}
+		return count >= least
+	}, nil
+}
+
+// sort sorts the rows by the sorters, the rows are in primary key order before sorting
+func (e *evaluator) sort(rows []*row, pbSort *otsprotocol.Sort) error {
+	type key struct {
+		field *FieldSchema
+		pk    bool
+		desc  bool
+		max   bool
+	}
+	var keys []key
+	for _, sorter := range pbSort.Sorter {
+		switch {
+		case sorter.FieldSort != nil:
+			fs, err := e.field(sorter.FieldSort.GetFieldName())
+			if err != nil {
+				return err
+			}
+			if fs.FieldType == FieldType_TEXT {
+				return fmt.Errorf("text field %s can not be sorted", *fs.FieldName)
+			}
+			keys = append(keys, key{
+				field: fs,
+				desc:  sorter.FieldSort.GetOrder() == otsprotocol.SortOrder_SORT_ORDER_DESC,
+				max:   sorter.FieldSort.GetMode() == otsprotocol.SortMode_SORT_MODE_MAX,
+			})
+		case sorter.PkSort != nil:
+			keys = append(keys, key{pk: true, desc: sorter.PkSort.GetOrder() == otsprotocol.SortOrder_SORT_ORDER_DESC})
+		case sorter.ScoreSort != nil:
+			// scores are all the same
+		default:
+			return errors.New("geo distance sort is not supported by memts")
+		}
+	}
+	// sortValue returns the min or max value of field, nil if it is missing
+	sortValue := func(r *row, k key) interface{} {
+		var value interface{}
+		for _, v := range e.values(r, k.field) {
+			if value == nil {
+				value = v
+				continue
+			}
+			if c, _ := compareValue(v, value); (k.max && c > 0) || (!k.max && c < 0) {
+				value = v
+			}
+		}
+		return value
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, k := range keys {
+			var c int
+			if k.pk {
+				c = comparePrimaryKeyValues(rows[i].pk, rows[j].pk)
+			} else {
+				a, b := sortValue(rows[i], k), sortValue(rows[j], k)
+				switch {
+				case a == nil && b == nil:
+					continue
+				case a == nil:
+					return false // missing values are always the last
+				case b == nil:
+					return true
+				}
+				c, _ = compareValue(a, b)
+			}
+			if k.desc {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	return nil
+}
+
+// matchWildcard matches s against pattern, * matches any sequence and ? matches any character
+func matchWildcard(pattern, s string) bool {
+	p, str := []rune(pattern), []rune(s)
+	if len(p) == 0 {
+		return len(str) == 0
+	}
+	switch p[0] {
+	case '*':
+		for i := 0; i <= len(str); i++ {
+			if matchWildcard(string(p[1:]), string(str[i:])) {
+				return true
+			}
+		}
+		return false
+	case '?':
+		return len(str) > 0 && matchWildcard(string(p[1:]), string(str[1:]))
+	}
+	return len(str) > 0 && p[0] == str[0] && matchWildcard(string(p[1:]), string(str[1:]))
+}
+
+// decodeVariant decodes the value encoded by search.ToVariantValue
+func decodeVariant(b []byte) (interface{}, error) {
+	if len(b) == 0 {
+		return nil, errors.New("empty variant value")
+	}
+	switch search.VariantType(b[0]) {
+	case search.VT_INTEGER:
+		if len(b) == 9 {
+			return int64(binary.LittleEndian.Uint64(b[1:])), nil
+		}
+	case search.VT_DOUBLE:
+		if len(b) == 9 {
+			return math.Float64frombits(binary.LittleEndian.Uint64(b[1:])), nil
+		}
+	case search.VT_BOOLEAN:
+		if len(b) == 2 {
+			return b[1] == 1, nil
+		}
+	case search.VT_STRING:
+		if len(b) >= 5 && int(binary.LittleEndian.Uint32(b[1:5])) == len(b)-5 {
+			return string(b[5:]), nil
+		}
+	}
+	return nil, fmt.Errorf("invalid variant value %v", b)
+}
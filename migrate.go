@@ -0,0 +1,390 @@
+package simplets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	. "github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+)
+
+// SchemaChangeKind is the part of a table which a SchemaChange alters
+type SchemaChangeKind string
+
+const (
+	ChangeCreateTable        SchemaChangeKind = "CreateTable"
+	ChangeTableOption        SchemaChangeKind = "TableOption"
+	ChangeReservedThroughput SchemaChangeKind = "ReservedThroughput"
+	ChangeStreamSpec         SchemaChangeKind = "StreamSpec"
+	ChangeDefinedColumn      SchemaChangeKind = "DefinedColumn"
+	ChangeIndex              SchemaChangeKind = "Index"
+)
+
+// SchemaChange is a difference between the live table and the struct with its EnsureTableOption
+type SchemaChange struct {
+	Kind SchemaChangeKind
+	// Name is the table name for ChangeCreateTable, the column name for ChangeDefinedColumn,
+	// the index name for ChangeIndex, otherwise the field name of TableOption, ReservedThroughput or StreamSpecification
+	Name string
+	// From is the value of the live table, nil if the defined column or index does not exist
+	From interface{}
+	// To is the desired value
+	To interface{}
+	// Safe changes never lose data and are applied by EnsureTable, unsafe changes are only reported
+	Safe bool
+	// Applied is true if the change has been made to the table
+	Applied bool
+}
+
+func (c SchemaChange) String() string {
+	if c.Kind == ChangeCreateTable {
+		return fmt.Sprintf("create table %s", c.Name)
+	}
+	return fmt.Sprintf("%s %s: %s -> %s", c.Kind, c.Name, formatChangeValue(c.From), formatChangeValue(c.To))
+}
+
+func formatChangeValue(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return "none"
+	case DefinedColumnType:
+		return formatDefinedColumnType(x)
+	case *IndexMeta:
+		return fmt.Sprintf("(%s) include (%s)", strings.Join(x.Primarykey, ", "), strings.Join(x.DefinedColumns, ", "))
+	}
+	return fmt.Sprint(v)
+}
+
+// TableUpdater is implemented by clients which can alter an existing table, MigrateTable needs it to apply
+// changes, *TableStoreClient satisfies it
+type TableUpdater interface {
+	UpdateTable(request *UpdateTableRequest) (*UpdateTableResponse, error)
+	AddDefinedColumn(request *AddDefinedColumnRequest) (*AddDefinedColumnResponse, error)
+	CreateIndex(request *CreateIndexRequest) (*CreateIndexResponse, error)
+}
+
+var _ TableUpdater = (*TableStoreClient)(nil)
+
+// MigrateTable is EnsureTableE which also returns the changes made to the table.
+// the table option, reserved throughput and stream spec of EnsureTableOption are compared with the live table if they
+// are provided, the ts_col fields with the defined option or ts_index tag must be defined columns of the table,
+// and the indexes declared by ts_index tags or EnsureTableOption.IndexMetas must exist.
+// safe changes are applied, unsafe ones are returned with Applied false, e.g. shortening the ttl, decreasing
+// max versions, disabling the stream, changing the type of a defined column or the primary keys of an index.
+// if EnsureTableOption.DryRun is set, nothing is changed and the planned changes are returned
+func MigrateTable(client Client, r interface{}, opts ...EnsureTableOption) ([]SchemaChange, error) {
+	return MigrateTableCtx(context.Background(), client, r, opts...)
+}
+
+// MigrateTableCtx is MigrateTable with a context
+func MigrateTableCtx(ctx context.Context, client Client, r interface{}, opts ...EnsureTableOption) ([]SchemaChange, error) {
+	var opt EnsureTableOption
+	if len(opts) == 1 {
+		opt = opts[0]
+	}
+	if err := Validate(r); err != nil {
+		return nil, err
+	}
+	s := getSchema(reflect.Indirect(reflect.ValueOf(r)).Type())
+	// the client passed in decides whether the table can be updated, the client bound to ctx may be a plain Client
+	updater, canUpdate := client.(TableUpdater)
+	clientType := reflect.TypeOf(client)
+	client, err := bindContext(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	if bound, ok := client.(TableUpdater); ok {
+		updater = bound
+	}
+	resp, err := client.DescribeTable(&DescribeTableRequest{TableName: s.table})
+	if err != nil {
+		err = substantiateError(err)
+		if !IsObjectNotExist(err) || opt.PanicIfTableNotExist {
+			return nil, err
+		}
+		changes := []SchemaChange{{Kind: ChangeCreateTable, Name: s.table, Safe: true}}
+		if opt.DryRun {
+			return changes, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := createTable(client, s, opt); err != nil {
+			return nil, err
+		}
+		changes[0].Applied = true
+		return changes, nil
+	}
+	if err := matchPrimaryKeys(s, resp.TableMeta.SchemaEntry); err != nil {
+		return nil, err
+	}
+	changes := diffTable(s, opt, resp)
+	if opt.DryRun {
+		return changes, nil
+	}
+	if !canUpdate {
+		for _, c := range changes {
+			if c.Safe {
+				return changes, &UpdateTableUnsupportedError{Table: s.table, Client: clientType, Changes: changes}
+			}
+		}
+		return changes, nil
+	}
+	return changes, applyChanges(ctx, updater, s.table, changes, resp, opt)
+}
+
+// ErrUpdateTableUnsupported is matched by *UpdateTableUnsupportedError with errors.Is
+var ErrUpdateTableUnsupported = errors.New("simple-tablestore: client does not implement TableUpdater")
+
+// UpdateTableUnsupportedError is returned by MigrateTable and EnsureTableE if the table has safe changes to
+// apply but the client does not implement TableUpdater, nothing is applied and Changes lists all the changes
+type UpdateTableUnsupportedError struct {
+	Table   string
+	Client  reflect.Type
+	Changes []SchemaChange
+}
+
+func (e *UpdateTableUnsupportedError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "simple-tablestore: %s does not implement TableUpdater, changes of table %s are not applied:", e.Client, e.Table)
+	for _, c := range e.Changes {
+		fmt.Fprintf(&b, " %s;", c)
+	}
+	return strings.TrimSuffix(b.String(), ";")
+}
+
+func (e *UpdateTableUnsupportedError) Unwrap() error {
+	return ErrUpdateTableUnsupported
+}
+
+func diffTable(s *schema, opt EnsureTableOption, resp *DescribeTableResponse) []SchemaChange {
+	var changes []SchemaChange
+	columns := make(map[string]DefinedColumnType)
+	for _, col := range resp.TableMeta.DefinedColumns {
+		columns[col.Name] = col.ColumnType
+	}
+	for _, col := range definedColumns(s) {
+		actual, ok := columns[col.Name]
+		if !ok {
+			changes = append(changes, SchemaChange{Kind: ChangeDefinedColumn, Name: col.Name, To: col.ColumnType, Safe: true})
+		} else if actual != col.ColumnType {
+			changes = append(changes, SchemaChange{Kind: ChangeDefinedColumn, Name: col.Name, From: actual, To: col.ColumnType})
+		}
+	}
+
+	indexes := make(map[string]*IndexMeta)
+	for _, meta := range resp.IndexMetas {
+		indexes[meta.IndexName] = meta
+	}
+	for _, meta := range indexMetas(s, opt) {
+		actual, ok := indexes[meta.IndexName]
+		if !ok {
+			changes = append(changes, SchemaChange{Kind: ChangeIndex, Name: meta.IndexName, To: meta, Safe: true})
+		} else if !equalStrings(actual.Primarykey, meta.Primarykey) {
+			// an index can not be altered, it must be dropped and created again. the included columns are not compared,
+			// they only decide which columns are filled by RangeIndex
+			changes = append(changes, SchemaChange{Kind: ChangeIndex, Name: meta.IndexName, From: actual, To: meta})
+		}
+	}
+
+	if want, live := opt.TableOption, resp.TableOption; want != nil && live != nil {
+		if want.TimeToAlive != live.TimeToAlive {
+			// a shorter ttl expires the data at once
+			safe := want.TimeToAlive == -1 || (live.TimeToAlive != -1 && want.TimeToAlive > live.TimeToAlive)
+			changes = append(changes, SchemaChange{Kind: ChangeTableOption, Name: "TimeToAlive", From: live.TimeToAlive, To: want.TimeToAlive, Safe: safe})
+		}
+		if want.MaxVersion != live.MaxVersion {
+			safe := want.MaxVersion > live.MaxVersion
+			changes = append(changes, SchemaChange{Kind: ChangeTableOption, Name: "MaxVersion", From: live.MaxVersion, To: want.MaxVersion, Safe: safe})
+		}
+		if want.DeviationCellVersionInSec > 0 && want.DeviationCellVersionInSec != live.DeviationCellVersionInSec {
+			changes = append(changes, SchemaChange{Kind: ChangeTableOption, Name: "DeviationCellVersionInSec",
+				From: live.DeviationCellVersionInSec, To: want.DeviationCellVersionInSec, Safe: true})
+		}
+	}
+
+	if want, live := opt.ReservedThroughput, resp.ReservedThroughput; want != nil && live != nil {
+		if want.Readcap != live.Readcap {
+			changes = append(changes, SchemaChange{Kind: ChangeReservedThroughput, Name: "Readcap", From: live.Readcap, To: want.Readcap, Safe: true})
+		}
+		if want.Writecap != live.Writecap {
+			changes = append(changes, SchemaChange{Kind: ChangeReservedThroughput, Name: "Writecap", From: live.Writecap, To: want.Writecap, Safe: true})
+		}
+	}
+
+	if want, live := opt.StreamSpec, resp.StreamDetails; want != nil && live != nil {
+		if want.EnableStream != live.EnableStream {
+			// disabling the stream drops the records not consumed yet
+			changes = append(changes, SchemaChange{Kind: ChangeStreamSpec, Name: "EnableStream", From: live.EnableStream, To: want.EnableStream, Safe: want.EnableStream})
+		} else if want.EnableStream && want.ExpirationTime != live.ExpirationTime {
+			// the expiration time can only be changed by disabling and enabling the stream again
+			changes = append(changes, SchemaChange{Kind: ChangeStreamSpec, Name: "ExpirationTime", From: live.ExpirationTime, To: want.ExpirationTime})
+		}
+	}
+	return changes
+}
+
+// applyChanges applies the safe changes, one request for each kind of changes
+func applyChanges(ctx context.Context, updater TableUpdater, table string, changes []SchemaChange, resp *DescribeTableResponse, opt EnsureTableOption) error {
+	pending := make(map[SchemaChangeKind]bool)
+	for _, c := range changes {
+		if c.Safe {
+			pending[c.Kind] = true
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	for _, kind := range []SchemaChangeKind{ChangeDefinedColumn, ChangeIndex, ChangeTableOption, ChangeReservedThroughput, ChangeStreamSpec} {
+		if !pending[kind] {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var err error
+		switch kind {
+		case ChangeDefinedColumn:
+			req := &AddDefinedColumnRequest{TableName: table}
+			for _, c := range changes {
+				if c.Kind == kind && c.Safe {
+					req.DefinedColumns = append(req.DefinedColumns, &DefinedColumnSchema{Name: c.Name, ColumnType: c.To.(DefinedColumnType)})
+				}
+			}
+			_, err = updater.AddDefinedColumn(req)
+		case ChangeIndex:
+			for _, c := range changes {
+				if c.Kind == kind && c.Safe && err == nil {
+					_, err = updater.CreateIndex(&CreateIndexRequest{MainTableName: table, IndexMeta: c.To.(*IndexMeta), IncludeBaseData: true})
+				}
+			}
+		case ChangeTableOption:
+			option := *resp.TableOption
+			for _, c := range changes {
+				if c.Kind != kind || !c.Safe {
+					continue
+				}
+				switch c.Name {
+				case "TimeToAlive":
+					option.TimeToAlive = c.To.(int)
+				case "MaxVersion":
+					option.MaxVersion = c.To.(int)
+				case "DeviationCellVersionInSec":
+					option.DeviationCellVersionInSec = c.To.(int64)
+				}
+			}
+			_, err = updater.UpdateTable(&UpdateTableRequest{TableName: table, TableOption: &option})
+		case ChangeReservedThroughput:
+			throughput := *opt.ReservedThroughput
+			_, err = updater.UpdateTable(&UpdateTableRequest{TableName: table, ReservedThroughput: &throughput})
+		case ChangeStreamSpec:
+			stream := *opt.StreamSpec
+			_, err = updater.UpdateTable(&UpdateTableRequest{TableName: table, StreamSpec: &stream})
+		}
+		if err != nil {
+			return substantiateError(err)
+		}
+		for i := range changes {
+			if changes[i].Kind == kind && changes[i].Safe {
+				changes[i].Applied = true
+			}
+		}
+	}
+	return nil
+}
+
+// definedColumns returns the defined columns declared by the struct
+func definedColumns(s *schema) []*DefinedColumnSchema {
+	var columns []*DefinedColumnSchema
+	for _, f := range s.cols {
+		if f.isDefinedCol {
+			columns = append(columns, &DefinedColumnSchema{Name: f.fieldName, ColumnType: definedColumnType(f.typ)})
+		}
+	}
+	return columns
+}
+
+// indexMetas returns EnsureTableOption.IndexMetas and the indexes declared by the struct, an index of the struct
+// includes all the other defined columns, so that RangeIndex reads them without touching the table
+func indexMetas(s *schema, opt EnsureTableOption) []*IndexMeta {
+	metas := append([]*IndexMeta(nil), opt.IndexMetas...)
+	for _, idx := range s.indexes {
+		if containsIndex(metas, idx.name) {
+			continue
+		}
+		meta := &IndexMeta{IndexName: idx.name, IndexType: IT_GLOBAL_INDEX}
+		for _, f := range idx.pks {
+			meta.Primarykey = append(meta.Primarykey, f.fieldName)
+		}
+		for _, f := range s.cols {
+			if f.isDefinedCol && !containsString(meta.Primarykey, f.fieldName) {
+				meta.DefinedColumns = append(meta.DefinedColumns, f.fieldName)
+			}
+		}
+		metas = append(metas, meta)
+	}
+	return metas
+}
+
+func containsIndex(metas []*IndexMeta, name string) bool {
+	for _, meta := range metas {
+		if meta.IndexName == name {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// definedColumnType returns the tablestore type of a defined column field, the field type is checked by Validate
+func definedColumnType(t reflect.Type) DefinedColumnType {
+	switch t.Kind() {
+	case reflect.Int64:
+		return DefinedColumn_INTEGER
+	case reflect.Float64:
+		return DefinedColumn_DOUBLE
+	case reflect.Bool:
+		return DefinedColumn_BOOLEAN
+	case reflect.String:
+		return DefinedColumn_STRING
+	}
+	return DefinedColumn_BINARY
+}
+
+func formatDefinedColumnType(t DefinedColumnType) string {
+	switch t {
+	case DefinedColumn_INTEGER:
+		return "INTEGER"
+	case DefinedColumn_DOUBLE:
+		return "DOUBLE"
+	case DefinedColumn_BOOLEAN:
+		return "BOOLEAN"
+	case DefinedColumn_STRING:
+		return "STRING"
+	case DefinedColumn_BINARY:
+		return "BINARY"
+	}
+	return fmt.Sprint(int32(t))
+}
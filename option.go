@@ -5,13 +5,23 @@ import . "github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
 type Options struct {
 	storeZeroValue bool
 	columnFilter   ColumnFilter
+	filter         *Filter
 	rowExistence   RowExistenceExpectation
+	columns        []string // struct fields to read, all the columns are read if it is empty
+	prefetch       int      // pages of Rows loaded ahead
+	pageSize       int32    // rows of a GetRange page
+	maxRows        int32    // max rows of Rows
+	maxPageBytes   int      // approximate max bytes of a GetRange page
 }
 
 type EnsureTableOption struct {
-	// panic if table is not exist when call EnsureTable, if this option is not provided, EnsureTable will create table automatically
+	// panic if table is not exist when call EnsureTable(EnsureTableE returns an error matching ErrObjectNotExist instead),
+	// if this option is not provided, EnsureTable will create table automatically
 	PanicIfTableNotExist bool
 
+	// do not create or alter the table, MigrateTable only returns the planned changes
+	DryRun bool
+
 	// option from tablestore sdk
 	TableOption        *TableOption
 	ReservedThroughput *ReservedThroughput
@@ -33,8 +43,61 @@ func ColumnFilterOption(f ColumnFilter) Option {
 	}
 }
 
+// FilterOption filters the rows read by GetRow, BatchGetRows, Range and RangeIndex on the server side, the fields
+// of filter are resolved for the struct type read. it is the column condition of writes like ColumnFilterOption.
+// the columns compared must be read, a column left out by Columns option is seen as missing
+func FilterOption(filter *Filter) Option {
+	return func(options *Options) {
+		options.filter = filter
+	}
+}
+
 func RowExistenceOption(r RowExistenceExpectation) Option {
 	return func(options *Options) {
 		options.rowExistence = r
 	}
 }
+
+// Columns makes GetRow, Range and RangeIndex read only the columns of the struct fields, the primary keys are always
+// read. a ts_col_prefix field is read by the column range of its prefix, so wide rows are read by the prefix, it can
+// not be read with other columns
+func Columns(fields ...string) Option {
+	return func(options *Options) {
+		options.columns = append(options.columns, fields...)
+	}
+}
+
+// Prefetch makes the Rows of Range, RangeIndex and Resume load up to pages pages ahead in a goroutine while the
+// current one is read. the goroutine starts at the first read and uses its context, it stops at the end of rows,
+// at the first error, which is returned after the rows before it, or when the Rows is closed or the context is done.
+// Close must be called if the rows are not read to the end, otherwise the goroutine waits for the next read until
+// the context of the first read is done
+func Prefetch(pages int) Option {
+	return func(options *Options) {
+		options.prefetch = pages
+	}
+}
+
+// PageSize sets the max rows of a GetRange page read by Range, RangeIndex and Resume, it is 50 by default and
+// tablestore allows 5000 at most. large pages save requests over small rows
+func PageSize(rows int32) Option {
+	return func(options *Options) {
+		options.pageSize = rows
+	}
+}
+
+// MaxRows limits the rows read by Range, RangeIndex and Resume, the smaller one is used if total is also given
+func MaxRows(rows int32) Option {
+	return func(options *Options) {
+		options.maxRows = rows
+	}
+}
+
+// MaxPageBytes limits the size of a GetRange page read by Range, RangeIndex and Resume approximately. tablestore
+// can not limit a page by size, so the rows of a page are limited by bytes over the average row size of the
+// previous page, the first page is limited by PageSize only. at least one row is read by a page
+func MaxPageBytes(bytes int) Option {
+	return func(options *Options) {
+		options.maxPageBytes = bytes
+	}
+}
@@ -0,0 +1,119 @@
+package simplets
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	. "github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+)
+
+// TableSplitter is implemented by clients which can split a table into ranges of similar size, ParallelScan uses
+// it to scan the splits concurrently, *TableStoreClient satisfies it
+type TableSplitter interface {
+	ComputeSplitPointsBySize(req *ComputeSplitPointsBySizeRequest) (*ComputeSplitPointsBySizeResponse, error)
+}
+
+var _ TableSplitter = (*TableStoreClient)(nil)
+
+// parallelScanSplitSize is the SplitSize of ComputeSplitPointsBySize, tablestore counts it by 100MB
+const parallelScanSplitSize = 1
+
+// ParallelScan scans the whole table of struct r, the table is split by ComputeSplitPointsBySize and the splits
+// are scanned by up to concurrency goroutines. every row is decoded into a new struct of the type of r and passed
+// to fn as a pointer, fn is called concurrently but the rows of a split are passed in primary key order.
+// the scan stops at the first error returned by fn or tablestore, which is returned after all goroutines exit.
+// the whole table is scanned as one split if client does not implement TableSplitter
+func ParallelScan(client Client, r interface{}, concurrency int, fn func(r interface{}) error) error {
+	return ParallelScanCtx(context.Background(), client, r, concurrency, fn)
+}
+
+// ParallelScanCtx is ParallelScan with a context, the scan stops and ctx.Err() is returned once ctx is done
+func ParallelScanCtx(ctx context.Context, client Client, r interface{}, concurrency int, fn func(r interface{}) error) error {
+	if err := Validate(r); err != nil {
+		return err
+	}
+	typ := reflect.Indirect(reflect.ValueOf(r)).Type()
+	s := getSchema(typ)
+	splits, err := computeSplits(ctx, client, s)
+	if err != nil {
+		return err
+	}
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	if concurrency > len(splits) {
+		concurrency = len(splits)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var once sync.Once
+	var firstErr error
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+	queue := make(chan *Split, len(splits))
+	for _, split := range splits {
+		queue <- split
+	}
+	close(queue)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for split := range queue {
+				if err := scanSplit(ctx, client, s, typ, split, fn); err != nil {
+					fail(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+func computeSplits(ctx context.Context, client Client, s *schema) ([]*Split, error) {
+	bound, err := bindContext(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	if splitter, ok := bound.(TableSplitter); ok {
+		resp, err := splitter.ComputeSplitPointsBySize(&ComputeSplitPointsBySizeRequest{TableName: s.table, SplitSize: parallelScanSplitSize})
+		if err != nil {
+			return nil, substantiateError(err)
+		}
+		return resp.Splits, nil
+	}
+	lower, upper := new(PrimaryKey), new(PrimaryKey)
+	for _, pk := range s.pks {
+		lower.AddPrimaryKeyColumnWithMinValue(pk.fieldName)
+		upper.AddPrimaryKeyColumnWithMaxValue(pk.fieldName)
+	}
+	return []*Split{{LowerBound: lower, UpperBound: upper}}, nil
+}
+
+func scanSplit(ctx context.Context, client Client, s *schema, typ reflect.Type, split *Split, fn func(r interface{}) error) error {
+	req := constructRangeRequest(s.table, nil, nil, nil, FORWARD, getSuitableLimit(0))
+	req.RangeRowQueryCriteria.StartPrimaryKey = split.LowerBound
+	req.RangeRowQueryCriteria.EndPrimaryKey = split.UpperBound
+	rows := &Rows{client: client, req: req, infinite: true}
+	for {
+		v := reflect.New(typ)
+		err := rows.ScanCtx(ctx, v.Interface())
+		if err == ErrRangeEnd {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(v.Interface()); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package simplets
+
+import (
+	"context"
+
+	. "github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+)
+
+// prefetcher loads the pages of Rows in a goroutine, pages is closed when the goroutine exits
+type prefetcher struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	pages  chan *rangePage
+	err    error // the error of a page, every read after it fails with it too
+}
+
+// startPrefetch loads the pages of req from start in a goroutine, at most pages pages are loaded but not read,
+// pages-1 of them are buffered and the last one is held by the goroutine until it is received.
+// the pages are sized by paging, it stops once remaining rows are loaded unless remaining is not positive
+func startPrefetch(ctx context.Context, client Client, req *GetRangeRequest, paging rangePaging, start *PrimaryKey, remaining int32, pages int) *prefetcher {
+	ctx, cancel := context.WithCancel(ctx)
+	p := &prefetcher{ctx: ctx, cancel: cancel, pages: make(chan *rangePage, pages-1)}
+	// the criteria is copied, Rows keeps the request to build Cursor
+	criteria := *req.RangeRowQueryCriteria
+	if start != nil {
+		criteria.StartPrimaryKey = start
+	}
+	go func() {
+		defer close(p.pages)
+		var loaded int32
+		var last *rangePage
+		for {
+			left := int32(0)
+			if remaining > 0 {
+				left = remaining - loaded
+			}
+			criteria.Limit = paging.limit(last, left)
+			page := getRangePage(ctx, client, &GetRangeRequest{RangeRowQueryCriteria: &criteria})
+			select {
+			case p.pages <- page:
+			case <-ctx.Done():
+				return
+			}
+			if page.err != nil || page.next == nil {
+				return
+			}
+			if loaded += int32(len(page.rows)); remaining > 0 && loaded >= remaining {
+				return
+			}
+			criteria.StartPrimaryKey = page.next
+			last = page
+		}
+	}()
+	return p
+}
+
+// prefetched returns the next page loaded by the prefetcher, which is started by the first call with its ctx
+func (i *Rows) prefetched(ctx context.Context) *rangePage {
+	p := i.prefetcher
+	if p == nil {
+		p = startPrefetch(ctx, i.client, i.req, i.paging, i.nextStartPrimaryKey, i.remaining(), i.prefetch)
+		i.prefetcher = p
+	}
+	if p.err != nil {
+		return &rangePage{err: p.err}
+	}
+	select {
+	case <-ctx.Done():
+		return &rangePage{err: ctx.Err()}
+	case page, ok := <-p.pages:
+		if !ok {
+			// the goroutine is stopped by the context of the first read
+			page = &rangePage{err: p.ctx.Err()}
+		}
+		if page.err != nil {
+			p.err = page.err
+		}
+		return page
+	}
+}
+
+// stopPrefetch stops the goroutine loading pages, the pages loaded are dropped
+func (i *Rows) stopPrefetch() {
+	if i.prefetcher != nil {
+		i.prefetcher.cancel()
+	}
+}
@@ -0,0 +1,365 @@
+package simplets
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	. "github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/search"
+)
+
+// Order is the sort order of Query.Sort
+type Order int
+
+const (
+	Asc Order = iota
+	Desc
+)
+
+// Query builds a search index query by the names of struct fields, e.g.
+//
+//	Where("Author").Eq("alice").And("Likes").Gt(3).Sort("Likes", Desc).Limit(20)
+//
+// conditions joined by And are evaluated before Or like sql. the fields and values are checked against the
+// ts_search tags by Build, Search builds the query for the element type of its destination
+type Query struct {
+	groups [][]*condition // conditions in a group are joined by AND, groups are joined by OR
+	field  string         // field of the next condition, set by Where, And and Or
+	sorts  []querySort
+	offset int32
+	limit  int32
+	total  bool
+}
+
+type condition struct {
+	field  string
+	op     string
+	values []interface{}
+}
+
+type querySort struct {
+	field string
+	order Order
+}
+
+// MatchAll returns a query matching all the rows, conditions can be added by And
+func MatchAll() *Query {
+	return &Query{groups: [][]*condition{nil}, offset: -1, limit: -1}
+}
+
+// Where returns a query whose first condition is on field
+func Where(field string) *Query {
+	q := MatchAll()
+	q.field = field
+	return q
+}
+
+// And starts a condition on field which must be satisfied together with the previous one
+func (q *Query) And(field string) *Query {
+	q.field = field
+	return q
+}
+
+// Or starts a condition on field, the query matches if the conditions before or after Or are satisfied
+func (q *Query) Or(field string) *Query {
+	q.groups = append(q.groups, nil)
+	q.field = field
+	return q
+}
+
+func (q *Query) add(op string, values ...interface{}) *Query {
+	last := len(q.groups) - 1
+	q.groups[last] = append(q.groups[last], &condition{field: q.field, op: op, values: values})
+	q.field = ""
+	return q
+}
+
+// Eq matches the rows whose field equals v, a text field matches if it has the word v
+func (q *Query) Eq(v interface{}) *Query { return q.add("Eq", v) }
+
+// Ne matches the rows whose field does not equal v
+func (q *Query) Ne(v interface{}) *Query { return q.add("Ne", v) }
+
+// Gt, Gte, Lt and Lte match the rows whose long, double or keyword field is in the range
+func (q *Query) Gt(v interface{}) *Query  { return q.add("Gt", v) }
+func (q *Query) Gte(v interface{}) *Query { return q.add("Gte", v) }
+func (q *Query) Lt(v interface{}) *Query  { return q.add("Lt", v) }
+func (q *Query) Lte(v interface{}) *Query { return q.add("Lte", v) }
+
+// In matches the rows whose field equals any of vs
+func (q *Query) In(vs ...interface{}) *Query { return q.add("In", vs...) }
+
+// Prefix matches the rows whose keyword field starts with prefix
+func (q *Query) Prefix(prefix string) *Query { return q.add("Prefix", prefix) }
+
+// Wildcard matches the rows whose keyword field matches pattern, * matches any sequence and ? matches any character
+func (q *Query) Wildcard(pattern string) *Query { return q.add("Wildcard", pattern) }
+
+// Match matches the rows whose text field has any word of text
+func (q *Query) Match(text string) *Query { return q.add("Match", text) }
+
+// MatchPhrase matches the rows whose text field has the words of text in order
+func (q *Query) MatchPhrase(text string) *Query { return q.add("MatchPhrase", text) }
+
+// Exists matches the rows which have a value of field
+func (q *Query) Exists() *Query { return q.add("Exists") }
+
+// Sort sorts the rows by field, the field must be declared with the sort option of ts_search tag
+func (q *Query) Sort(field string, order Order) *Query {
+	q.sorts = append(q.sorts, querySort{field: field, order: order})
+	return q
+}
+
+// Offset skips the first n rows
+func (q *Query) Offset(n int32) *Query {
+	q.offset = n
+	return q
+}
+
+// Limit sets the max count of rows returned by one search, tablestore returns 10 rows if it is not set
+func (q *Query) Limit(n int32) *Query {
+	q.limit = n
+	return q
+}
+
+// CountTotal makes Search return the count of all the matched rows in SearchResult.TotalCount
+func (q *Query) CountTotal() *Query {
+	q.total = true
+	return q
+}
+
+// SearchQuery is the query of Search, SearchIter, ResumeSearch and Aggregate, it is either a *Query, which is built
+// for the struct type searched, or a query built by the sdk and wrapped by SDKQuery
+type SearchQuery interface {
+	searchQuery(s *schema) (search.SearchQuery, error)
+}
+
+func (q *Query) searchQuery(s *schema) (search.SearchQuery, error) {
+	return q.build(s)
+}
+
+// SDKQuery wraps a query built by the sdk, e.g. by search.NewSearchQuery or Query.Build, it is sent as it is
+func SDKQuery(query search.SearchQuery) SearchQuery {
+	return sdkQuery{query: query}
+}
+
+type sdkQuery struct {
+	query search.SearchQuery
+}
+
+func (q sdkQuery) searchQuery(*schema) (search.SearchQuery, error) {
+	return q.query, nil
+}
+
+// QueryError reports every invalid condition and sort of a Query found by Build
+type QueryError struct {
+	Type   reflect.Type
+	Errors []FieldError
+}
+
+func (e *QueryError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "simple-tablestore: invalid query of %s:", e.Type)
+	for _, fe := range e.Errors {
+		fmt.Fprintf(&b, " %s: %s;", fe.Field, fe.Reason)
+	}
+	return strings.TrimSuffix(b.String(), ";")
+}
+
+// Build checks the fields and values against the ts_search tags of struct r and returns the query for the sdk,
+// a *QueryError listing every problem is returned if the query is invalid
+func (q *Query) Build(r interface{}) (search.SearchQuery, error) {
+	if err := Validate(r); err != nil {
+		return nil, err
+	}
+	return q.build(getSchema(reflect.Indirect(reflect.ValueOf(r)).Type()))
+}
+
+func (q *Query) build(s *schema) (search.SearchQuery, error) {
+	e := &QueryError{Type: s.typ}
+	sq := search.NewSearchQuery().SetQuery(q.query(s, e))
+
+	var sorters []search.Sorter
+	for _, qs := range q.sorts {
+		f, err := searchField(s, qs.field)
+		if err == nil && !f.search.sortAndAgg {
+			err = errors.New("sort option of ts_search tag is required to sort")
+		}
+		if err != nil {
+			e.Errors = append(e.Errors, FieldError{Field: qs.field, Reason: err.Error()})
+			continue
+		}
+		order := search.SortOrder_ASC
+		if qs.order == Desc {
+			order = search.SortOrder_DESC
+		}
+		sorters = append(sorters, &search.FieldSort{FieldName: f.fieldName, Order: order.Enum()})
+	}
+	if len(e.Errors) > 0 {
+		return nil, e
+	}
+	if len(sorters) > 0 {
+		sq.SetSort(&search.Sort{Sorters: sorters})
+	}
+	if q.offset >= 0 {
+		sq.SetOffset(q.offset)
+	}
+	if q.limit >= 0 {
+		sq.SetLimit(q.limit)
+	}
+	sq.SetGetTotalCount(q.total)
+	return sq, nil
+}
+
+// query returns the sdk query of the conditions, the problems are appended to e
+func (q *Query) query(s *schema, e *QueryError) search.Query {
+	if q.field != "" {
+		e.Errors = append(e.Errors, FieldError{Field: q.field, Reason: "no condition follows Where, And or Or"})
+	}
+	var groups []search.Query
+	for _, group := range q.groups {
+		var must, mustNot []search.Query
+		for _, c := range group {
+			query, negative, err := c.build(s)
+			if err != nil {
+				e.Errors = append(e.Errors, FieldError{Field: c.field, Reason: err.Error()})
+				continue
+			}
+			if negative {
+				mustNot = append(mustNot, query)
+			} else {
+				must = append(must, query)
+			}
+		}
+		switch {
+		case len(must) == 0 && len(mustNot) == 0:
+			groups = append(groups, &search.MatchAllQuery{})
+		case len(must) == 1 && len(mustNot) == 0:
+			groups = append(groups, must[0])
+		default:
+			groups = append(groups, &search.BoolQuery{MustQueries: must, MustNotQueries: mustNot})
+		}
+	}
+	if len(groups) == 1 {
+		return groups[0]
+	}
+	least := int32(1)
+	return &search.BoolQuery{ShouldQueries: groups, MinimumShouldMatch: &least}
+}
+
+// searchField returns the struct field with ts_search tag by its name
+func searchField(s *schema, name string) (*schemaField, error) {
+	for _, f := range s.searchFields {
+		if f.name == name {
+			return f, nil
+		}
+	}
+	for _, f := range s.fields {
+		if f.name == name {
+			return nil, errors.New("field has no ts_search tag")
+		}
+	}
+	return nil, errors.New("field does not exist")
+}
+
+// build returns the sdk query of condition, negative is true if the query must not be matched
+func (c *condition) build(s *schema) (query search.Query, negative bool, err error) {
+	if c.field == "" {
+		return nil, false, fmt.Errorf("%s must follow Where, And or Or", c.op)
+	}
+	f, err := searchField(s, c.field)
+	if err != nil {
+		return nil, false, err
+	}
+	st := f.search
+	name := f.fieldName
+	values := make([]interface{}, len(c.values))
+	for i, v := range c.values {
+		if values[i], err = searchValue(st.fieldType, v); err != nil {
+			return nil, false, err
+		}
+	}
+	ordered := st.fieldType == FieldType_LONG || st.fieldType == FieldType_DOUBLE || st.fieldType == FieldType_KEYWORD
+	literal := st.fieldType == FieldType_KEYWORD || st.fieldType == FieldType_TEXT
+	switch c.op {
+	case "Eq":
+		return &search.TermQuery{FieldName: name, Term: values[0]}, false, nil
+	case "Ne":
+		return &search.TermQuery{FieldName: name, Term: values[0]}, true, nil
+	case "In":
+		if len(values) == 0 {
+			return nil, false, errors.New("In requires at least one value")
+		}
+		return &search.TermsQuery{FieldName: name, Terms: values}, false, nil
+	case "Gt", "Gte", "Lt", "Lte":
+		if !ordered {
+			return nil, false, fmt.Errorf("%s is not allowed on %s field", c.op, searchFieldTypeNames[st.fieldType])
+		}
+		rq := &search.RangeQuery{FieldName: name}
+		switch c.op {
+		case "Gt":
+			rq.GT(values[0])
+		case "Gte":
+			rq.GTE(values[0])
+		case "Lt":
+			rq.LT(values[0])
+		case "Lte":
+			rq.LTE(values[0])
+		}
+		return rq, false, nil
+	case "Prefix", "Wildcard":
+		if st.fieldType != FieldType_KEYWORD {
+			return nil, false, fmt.Errorf("%s is only allowed on keyword field", c.op)
+		}
+		if c.op == "Prefix" {
+			return &search.PrefixQuery{FieldName: name, Prefix: values[0].(string)}, false, nil
+		}
+		return &search.WildcardQuery{FieldName: name, Value: values[0].(string)}, false, nil
+	case "Match", "MatchPhrase":
+		if !literal {
+			return nil, false, fmt.Errorf("%s is only allowed on text and keyword field", c.op)
+		}
+		if c.op == "Match" {
+			return &search.MatchQuery{FieldName: name, Text: values[0].(string)}, false, nil
+		}
+		return &search.MatchPhraseQuery{FieldName: name, Text: values[0].(string)}, false, nil
+	case "Exists":
+		return &search.ExistsQuery{FieldName: name}, false, nil
+	}
+	return nil, false, fmt.Errorf("unknown operator %s", c.op)
+}
+
+// searchValue converts v into the value type of search field, integers are accepted by long and double fields
+func searchValue(fieldType FieldType, v interface{}) (interface{}, error) {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return nil, errors.New("value can not be nil")
+	}
+	switch fieldType {
+	case FieldType_LONG:
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return rv.Int(), nil
+		case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+			return int64(rv.Uint()), nil
+		}
+	case FieldType_DOUBLE:
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return float64(rv.Int()), nil
+		case reflect.Float32, reflect.Float64:
+			return rv.Float(), nil
+		}
+	case FieldType_BOOLEAN:
+		if rv.Kind() == reflect.Bool {
+			return rv.Bool(), nil
+		}
+	default:
+		if rv.Kind() == reflect.String {
+			return rv.String(), nil
+		}
+	}
+	return nil, fmt.Errorf("value %v(%T) does not match %s field", v, v, searchFieldTypeNames[fieldType])
+}
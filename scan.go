@@ -1,7 +1,11 @@
 package simplets
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"reflect"
 
 	. "github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
@@ -10,33 +14,32 @@ import (
 //var ErrNoRows = errors.New("simple-tablestore: no rows in result set")
 var ErrRangeEnd = errors.New("simple-tablestore: range query end")
 
-func constructRangeRequest(r interface{}, froms, tos []interface{}, direction Direction, limit int32) *GetRangeRequest {
-	v := reflect.ValueOf(r)
-	t := v.Type()
-	pk, _, table := generateInfo(v, t)
+// constructRangeRequest builds the request to read table or index whose primary keys are keys,
+// the value of a hash primary key is hashed like the written one
+func constructRangeRequest(table string, keys []*schemaField, froms, tos []interface{}, direction Direction, limit int32) *GetRangeRequest {
 	getRangeRequest := &GetRangeRequest{}
 	rangeRowQueryCriteria := &RangeRowQueryCriteria{}
 	rangeRowQueryCriteria.TableName = table
 
 	startPK := new(PrimaryKey)
 	endPK := new(PrimaryKey)
-	for i, p := range pk.PrimaryKeys {
+	for i, p := range keys {
 		from := froms[i]
 		to := tos[i]
-		pkName := p.ColumnName
+		pkName := p.fieldName
 		if from == MIN {
 			startPK.AddPrimaryKeyColumnWithMinValue(pkName)
 		} else if from == MAX {
 			startPK.AddPrimaryKeyColumnWithMaxValue(pkName)
 		} else {
-			startPK.AddPrimaryKeyColumn(pkName, getSupportedValue(from))
+			startPK.AddPrimaryKeyColumn(pkName, rangeKeyValue(p, from))
 		}
 		if to == MIN {
 			endPK.AddPrimaryKeyColumnWithMinValue(pkName)
 		} else if to == MAX {
 			endPK.AddPrimaryKeyColumnWithMaxValue(pkName)
 		} else {
-			endPK.AddPrimaryKeyColumn(pkName, getSupportedValue(to))
+			endPK.AddPrimaryKeyColumn(pkName, rangeKeyValue(p, to))
 		}
 	}
 	rangeRowQueryCriteria.StartPrimaryKey = startPK
@@ -48,8 +51,16 @@ func constructRangeRequest(r interface{}, froms, tos []interface{}, direction Di
 	return getRangeRequest
 }
 
+func rangeKeyValue(f *schemaField, v interface{}) interface{} {
+	v = getSupportedValue(v)
+	if str, ok := v.(string); ok && f.isHashPk {
+		return addHashPrefix(str)
+	}
+	return v
+}
+
 type Rows struct {
-	client              *TableStoreClient
+	client              Client
 	req                 *GetRangeRequest
 	nextStartPrimaryKey *PrimaryKey
 	noNextBatch         bool
@@ -57,9 +68,42 @@ type Rows struct {
 	total               int32
 	infinite            bool
 	end                 bool
+	projection          *readProjection
 
 	cursor int
 	rows   []*Row
+
+	// state of Next, Scan reads the row fetched by Next once Next is called
+	iterating bool
+	row       *Row
+	err       error
+	closed    bool
+
+	prefetch   int // count of pages loaded ahead, 0 disables prefetching
+	prefetcher *prefetcher
+
+	paging        rangePaging
+	lastPage      *rangePage
+	pages         int
+	capacityUnits int64
+}
+
+// remaining returns the count of rows left to read, 0 means no limit
+func (i *Rows) remaining() int32 {
+	if i.infinite {
+		return 0
+	}
+	return i.total - i.count
+}
+
+// Pages returns the count of GetRange pages read so far, the pages loaded by Prefetch are counted once read
+func (i *Rows) Pages() int {
+	return i.pages
+}
+
+// CapacityUnits returns the read capacity units consumed by the pages read so far
+func (i *Rows) CapacityUnits() int64 {
+	return i.capacityUnits
 }
 
 func (i *Rows) isEnd() bool {
@@ -76,56 +120,489 @@ func (i *Rows) isEnd() bool {
 	return int32(i.cursor) == i.total
 }
 
+// Scan scans the next row into r and returns ErrRangeEnd if there are no more rows. once Next is called, Scan
+// works like database/sql instead, it scans the row fetched by the last Next into r
 func (i *Rows) Scan(r interface{}) error {
-	if i.isEnd() {
+	return i.ScanCtx(context.Background(), r)
+}
+
+// ScanCtx is Scan with a context, it returns ctx.Err() once ctx is done, the next page is not fetched then
+func (i *Rows) ScanCtx(ctx context.Context, r interface{}) error {
+	if err := loadSchema(reflect.TypeOf(r).Elem()).err; err != nil {
+		return err
+	}
+	if i.closed {
 		return ErrRangeEnd
 	}
-	if i.cursor == len(i.rows) {
-		req := i.req
-		if i.nextStartPrimaryKey != nil {
-			req.RangeRowQueryCriteria.StartPrimaryKey = i.nextStartPrimaryKey
+	if i.iterating {
+		if i.row == nil {
+			return errors.New("simple-tablestore: Scan called without a row fetched by Next")
 		}
-		getRangeResp, err := i.client.GetRange(i.req)
-		if err != nil {
-			return err
+		fillStructFromRow(reflect.ValueOf(r).Elem(), i.row)
+		return nil
+	}
+	row, err := i.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	fillStructFromRow(reflect.ValueOf(r).Elem(), row)
+	return nil
+}
+
+// Next fetches the next row to be read by Scan, it returns false if there are no more rows, an error occurs or
+// Rows is closed, Err tells the error apart from the end
+//
+//	for rows.Next() {
+//		if err := rows.Scan(r); err != nil {
+//			...
+//		}
+//	}
+//	if err := rows.Err(); err != nil {
+//		...
+//	}
+func (i *Rows) Next() bool {
+	return i.NextCtx(context.Background())
+}
+
+// NextCtx is Next with a context, Err returns ctx.Err() if ctx is done
+func (i *Rows) NextCtx(ctx context.Context) bool {
+	i.iterating = true
+	i.row = nil
+	if i.closed || i.err != nil {
+		return false
+	}
+	row, err := i.fetch(ctx)
+	if err != nil {
+		if err != ErrRangeEnd {
+			i.err = err
+		}
+		return false
+	}
+	i.row = row
+	return true
+}
+
+// Err returns the error stopping Next, it is nil if the rows are read to the end or Rows is closed
+func (i *Rows) Err() error {
+	return i.err
+}
+
+// Close stops the scan, Next returns false and Scan returns ErrRangeEnd afterwards. without Prefetch the pages
+// are fetched on demand so there is nothing to release, with Prefetch Close stops the loading goroutine and must
+// be called if the rows are not read to the end. Cursor still returns the position after the last row read
+func (i *Rows) Close() error {
+	i.closed = true
+	i.row = nil
+	i.stopPrefetch()
+	return nil
+}
+
+// fetch returns the next row, ErrRangeEnd is returned if there are no more rows
+func (i *Rows) fetch(ctx context.Context) (*Row, error) {
+	if i.err != nil {
+		return nil, i.err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if i.closed || i.isEnd() {
+		return nil, ErrRangeEnd
+	}
+	// a page may be empty but not the last one if all its rows are dropped by the filter
+	for i.cursor == len(i.rows) {
+		if i.noNextBatch {
+			return nil, ErrRangeEnd
+		}
+		var page *rangePage
+		if i.prefetch > 0 {
+			page = i.prefetched(ctx)
+		} else {
+			if i.nextStartPrimaryKey != nil {
+				i.req.RangeRowQueryCriteria.StartPrimaryKey = i.nextStartPrimaryKey
+			}
+			i.req.RangeRowQueryCriteria.Limit = i.paging.limit(i.lastPage, i.remaining())
+			page = getRangePage(ctx, i.client, i.req)
 		}
-		if len(getRangeResp.Rows) == 0 {
-			return ErrRangeEnd
+		if page.err != nil {
+			i.stopPrefetch()
+			return nil, page.err
 		}
+		i.lastPage = page
+		i.pages++
+		i.capacityUnits += page.cu
 		i.cursor = 0
-		i.rows = getRangeResp.Rows
-		i.nextStartPrimaryKey = getRangeResp.NextStartPrimaryKey
+		i.rows = page.rows
+		i.nextStartPrimaryKey = page.next
 		if i.nextStartPrimaryKey == nil {
 			i.noNextBatch = true
+			i.stopPrefetch()
 		}
 	}
-	v := reflect.ValueOf(r).Elem()
-	t := v.Type()
-	_, fields, _ := generateInfo(v, t)
 	row := i.rows[i.cursor]
-	fillPKsToFieldInfos(*row.PrimaryKey, fields)
-	fillColsToFieldInfos(row.Columns, fields)
-	fillStructFromFields(t, v, fields)
+	if i.projection != nil {
+		row = &Row{PrimaryKey: row.PrimaryKey, Columns: i.projection.project(row.Columns)}
+	}
 	i.cursor++
 	i.count++
 	if !i.infinite && i.count == i.total {
 		i.end = true
+		i.stopPrefetch()
 	}
-	return nil
+	return row, nil
+}
+
+// rangePage is a page of GetRange, next is nil if it is the last page
+type rangePage struct {
+	rows  []*Row
+	next  *PrimaryKey
+	bytes int   // approximate size of rows
+	cu    int64 // read capacity units consumed
+	err   error
+}
+
+func getRangePage(ctx context.Context, client Client, req *GetRangeRequest) *rangePage {
+	client, err := bindContext(ctx, client)
+	if err != nil {
+		return &rangePage{err: err}
+	}
+	resp, err := client.GetRange(req)
+	if err != nil {
+		return &rangePage{err: substantiateError(err)}
+	}
+	page := &rangePage{rows: resp.Rows, next: resp.NextStartPrimaryKey}
+	for _, row := range resp.Rows {
+		page.bytes += rowBytes(row)
+	}
+	if resp.ConsumedCapacityUnit != nil {
+		page.cu = int64(resp.ConsumedCapacityUnit.Read)
+	}
+	return page
+}
+
+// Range reads the rows of struct r from froms to tos, which are the primary keys of r in order. at most total
+// rows are scanned unless it is not positive, Columns option limits the columns to read and FilterOption drops
+// the rows not passing the filter on the server side. invalid keys or options are returned by the first read
+func Range(client Client, r interface{}, froms, tos []interface{}, direction Direction, total int32, setters ...Option) *Rows {
+	s := loadSchema(reflect.Indirect(reflect.ValueOf(r)).Type())
+	if s.err != nil {
+		return &Rows{err: s.err}
+	}
+	rows, err := newRangeRows(client, s, s.table, s.pks, froms, tos, direction, total, setters)
+	if err != nil {
+		return &Rows{err: err}
+	}
+	return rows
+}
+
+// RangeIndex is Range over a secondary index declared by ts_index tags of r, the rows are scanned into
+// the struct type of r. froms and tos are the columns of index in order followed by the primary keys of r.
+// only the columns included by the index are filled, a struct index includes all the defined columns.
+// an undeclared index is returned by the first read like invalid options
+func RangeIndex(client Client, r interface{}, index string, froms, tos []interface{}, direction Direction, total int32, setters ...Option) *Rows {
+	s := loadSchema(reflect.Indirect(reflect.ValueOf(r)).Type())
+	if s.err != nil {
+		return &Rows{err: s.err}
+	}
+	idx := s.index(index)
+	if idx == nil {
+		return &Rows{err: fmt.Errorf("simple-tablestore: index %s is not declared by %T", index, r)}
+	}
+	rows, err := newRangeRows(client, s, index, idx.keys(s), froms, tos, direction, total, setters)
+	if err != nil {
+		return &Rows{err: err}
+	}
+	return rows
+}
+
+// newRangeRows returns the rows of table or index from froms to tos, whose counts must match keys
+func newRangeRows(client Client, s *schema, table string, keys []*schemaField, froms, tos []interface{}, direction Direction, total int32, setters []Option) (*Rows, error) {
+	if len(froms) != len(keys) || len(tos) != len(keys) {
+		return nil, fmt.Errorf("simple-tablestore: range of %s needs %d primary keys, got %d and %d", table, len(keys), len(froms), len(tos))
+	}
+	return newRows(client, s, constructRangeRequest(table, keys, froms, tos, direction, getSuitableLimit(total)), total, setters)
+}
+
+// RangeAll is Range collecting all the rows into dst, which must be a pointer to a slice of the struct type of r or
+// its pointer, e.g. &[]T{} or &[]*T{}. dst is replaced by the rows read, if a page fails midway the rows read
+// before it are kept in dst and the error is returned
+func RangeAll(client Client, r interface{}, froms, tos []interface{}, direction Direction, total int32, dst interface{}, setters ...Option) error {
+	return RangeAllCtx(context.Background(), client, r, froms, tos, direction, total, dst, setters...)
+}
+
+// RangeAllCtx is RangeAll with a context
+func RangeAllCtx(ctx context.Context, client Client, r interface{}, froms, tos []interface{}, direction Direction, total int32, dst interface{}, setters ...Option) error {
+	typ := reflect.Indirect(reflect.ValueOf(r)).Type()
+	if _, elem, err := sliceOf(dst); err != nil {
+		return err
+	} else if elem != typ {
+		return fmt.Errorf("simple-tablestore: %T can not hold the rows of %s", dst, typ)
+	}
+	s := getSchema(typ)
+	rows, err := newRangeRows(client, s, s.table, s.pks, froms, tos, direction, total, setters)
+	if err != nil {
+		return err
+	}
+	return ScanAllCtx(ctx, rows, dst)
+}
+
+// ScanAll scans the rows not read yet into dst, which must be a pointer to a slice of struct or struct pointer,
+// e.g. &[]T{} or &[]*T{}. dst is replaced by the rows read, if a page fails midway the rows read before it
+// are kept in dst and the error is returned
+func ScanAll(rows *Rows, dst interface{}) error {
+	return ScanAllCtx(context.Background(), rows, dst)
 }
 
-func Range(client *TableStoreClient, r interface{}, froms, tos []interface{}, direction Direction, total int32) *Rows {
+// ScanAllCtx is ScanAll with a context
+func ScanAllCtx(ctx context.Context, rows *Rows, dst interface{}) error {
+	slice, _, err := sliceOf(dst)
+	if err != nil {
+		return err
+	}
+	slice.Set(reflect.MakeSlice(slice.Type(), 0, 0))
+	for {
+		row, err := rows.fetch(ctx)
+		if err == ErrRangeEnd {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		appendRow(slice, row)
+	}
+}
+
+// newRows returns the rows read by req, the error of invalid options is returned
+func newRows(client Client, s *schema, req *GetRangeRequest, total int32, setters []Option) (*Rows, error) {
+	opts := &Options{}
+	for _, set := range setters {
+		set(opts)
+	}
+	projection, err := projectColumns(s, opts.columns)
+	if err != nil {
+		return nil, err
+	}
+	if req.RangeRowQueryCriteria.Filter, err = opts.columnFilterOf(s); err != nil {
+		return nil, err
+	}
+	if projection != nil {
+		criteria := req.RangeRowQueryCriteria
+		criteria.ColumnsToGet, criteria.StartColumn, criteria.EndColumn = projection.columns, projection.start, projection.end
+	}
+	if opts.maxRows > 0 && (total <= 0 || opts.maxRows < total) {
+		total = opts.maxRows
+	}
 	return &Rows{
-		client:   client,
-		req:      constructRangeRequest(r, froms, tos, direction, getSuitableLimit(total)),
-		total:    total,
-		infinite: total <= 0,
+		client:     client,
+		req:        req,
+		total:      total,
+		infinite:   total <= 0,
+		projection: projection,
+		prefetch:   opts.prefetch,
+		paging:     rangePaging{pageSize: opts.pageSize, maxBytes: opts.maxPageBytes},
+	}, nil
+}
+
+// rangeCursor is the position of Rows, the scan continues at Start of table
+type rangeCursor struct {
+	Table     string      `json:"t"`
+	Start     []cursorKey `json:"s"`
+	End       []cursorKey `json:"e"`
+	Backward  bool        `json:"b,omitempty"`
+	Remaining int32       `json:"r,omitempty"` // rows left to scan, 0 means no limit
+}
+
+// cursorKey is a primary key column of rangeCursor, Type is one of string, integer, binary, min and max
+type cursorKey struct {
+	Name   string `json:"n"`
+	Type   string `json:"t"`
+	String string `json:"s,omitempty"`
+	Int    int64  `json:"i,omitempty"`
+	Binary []byte `json:"b,omitempty"`
+}
+
+func encodeCursorKeys(pk *PrimaryKey) []cursorKey {
+	keys := make([]cursorKey, 0, len(pk.PrimaryKeys))
+	for _, col := range pk.PrimaryKeys {
+		key := cursorKey{Name: col.ColumnName}
+		switch v := col.Value.(type) {
+		case string:
+			key.Type, key.String = "string", v
+		case int64:
+			key.Type, key.Int = "integer", v
+		case []byte:
+			key.Type, key.Binary = "binary", v
+		}
+		switch col.PrimaryKeyOption {
+		case MIN:
+			key.Type = "min"
+		case MAX:
+			key.Type = "max"
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func decodeCursorKeys(keys []cursorKey, schema []*schemaField) (*PrimaryKey, error) {
+	if len(keys) != len(schema) {
+		return nil, fmt.Errorf("expect %d primary keys, got %d", len(schema), len(keys))
+	}
+	pk := new(PrimaryKey)
+	for i, key := range keys {
+		if key.Name != schema[i].fieldName {
+			return nil, fmt.Errorf("expect primary key %s, got %s", schema[i].fieldName, key.Name)
+		}
+		switch key.Type {
+		case "string":
+			pk.AddPrimaryKeyColumn(key.Name, key.String)
+		case "integer":
+			pk.AddPrimaryKeyColumn(key.Name, key.Int)
+		case "binary":
+			pk.AddPrimaryKeyColumn(key.Name, key.Binary)
+		case "min":
+			pk.AddPrimaryKeyColumnWithMinValue(key.Name)
+		case "max":
+			pk.AddPrimaryKeyColumnWithMaxValue(key.Name)
+		default:
+			return nil, fmt.Errorf("unknown type %s of primary key %s", key.Type, key.Name)
+		}
+	}
+	return pk, nil
+}
+
+// Cursor returns an opaque position of the rows which is safe to persist or hand to a client, Resume continues
+// at the row following the last scanned one with the rest of total. an empty cursor is returned once the rows
+// are all scanned
+func (i *Rows) Cursor() string {
+	if i.req == nil || i.isEnd() {
+		return ""
+	}
+	criteria := i.req.RangeRowQueryCriteria
+	start := criteria.StartPrimaryKey
+	if i.cursor < len(i.rows) {
+		start = i.rows[i.cursor].PrimaryKey
+	} else if i.rows != nil {
+		start = i.nextStartPrimaryKey
+	}
+	c := rangeCursor{
+		Table:    criteria.TableName,
+		Start:    encodeCursorKeys(start),
+		End:      encodeCursorKeys(criteria.EndPrimaryKey),
+		Backward: criteria.Direction == BACKWARD,
 	}
+	if !i.infinite {
+		c.Remaining = i.total - i.count
+	}
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
 }
 
+// Resume continues the Range or RangeIndex of struct r at cursor returned by Rows.Cursor, the options are not kept
+// by cursor, pass them again to read the same columns and rows
+func Resume(client Client, r interface{}, cursor string, setters ...Option) (*Rows, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("simple-tablestore: invalid range cursor: %v", err)
+	}
+	var c rangeCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Remaining < 0 {
+		return nil, errors.New("simple-tablestore: invalid range cursor")
+	}
+	s := loadSchema(reflect.Indirect(reflect.ValueOf(r)).Type())
+	if s.err != nil {
+		return nil, s.err
+	}
+	keys := s.pks
+	if c.Table != s.table {
+		idx := s.index(c.Table)
+		if idx == nil {
+			return nil, fmt.Errorf("simple-tablestore: range cursor of %s does not belong to %T", c.Table, r)
+		}
+		keys = idx.keys(s)
+	}
+	start, err := decodeCursorKeys(c.Start, keys)
+	if err != nil {
+		return nil, fmt.Errorf("simple-tablestore: invalid range cursor: %v", err)
+	}
+	end, err := decodeCursorKeys(c.End, keys)
+	if err != nil {
+		return nil, fmt.Errorf("simple-tablestore: invalid range cursor: %v", err)
+	}
+	direction := FORWARD
+	if c.Backward {
+		direction = BACKWARD
+	}
+	req := constructRangeRequest(c.Table, nil, nil, nil, direction, getSuitableLimit(c.Remaining))
+	req.RangeRowQueryCriteria.StartPrimaryKey = start
+	req.RangeRowQueryCriteria.EndPrimaryKey = end
+	return newRows(client, s, req, c.Remaining, setters)
+}
+
+const (
+	defaultRangePageSize = 50
+	// the max rows of one GetRange request allowed by tablestore
+	maxRangePageSize = 5000
+)
+
 func getSuitableLimit(total int32) int32 {
-	if total <= 0 || total > 50 {
-		return 50
+	if total <= 0 || total > defaultRangePageSize {
+		return defaultRangePageSize
 	}
 	return total
 }
+
+// rangePaging decides the Limit of every GetRange request of Rows
+type rangePaging struct {
+	pageSize int32 // max rows of a page, defaultRangePageSize if it is not positive
+	maxBytes int   // approximate max bytes of a page, 0 means no limit
+}
+
+// limit returns the Limit of the page after last, which is nil for the first page. the rows of a page are limited
+// by remaining unless it is not positive, and by maxBytes over the average row size of last
+func (p rangePaging) limit(last *rangePage, remaining int32) int32 {
+	limit := p.pageSize
+	if limit <= 0 {
+		limit = defaultRangePageSize
+	}
+	if limit > maxRangePageSize {
+		limit = maxRangePageSize
+	}
+	if p.maxBytes > 0 && last != nil && len(last.rows) > 0 && last.bytes > 0 {
+		if n := int64(p.maxBytes) * int64(len(last.rows)) / int64(last.bytes); n < int64(limit) {
+			limit = int32(n)
+		}
+	}
+	if remaining > 0 && remaining < limit {
+		limit = remaining
+	}
+	if limit < 1 {
+		limit = 1
+	}
+	return limit
+}
+
+// rowBytes is the approximate size of row, the names and values of the primary keys and columns
+func rowBytes(row *Row) int {
+	size := 0
+	if row.PrimaryKey != nil {
+		for _, pk := range row.PrimaryKey.PrimaryKeys {
+			size += len(pk.ColumnName) + valueBytes(pk.Value)
+		}
+	}
+	for _, col := range row.Columns {
+		size += len(col.ColumnName) + valueBytes(col.Value)
+	}
+	return size
+}
+
+func valueBytes(v interface{}) int {
+	switch v := v.(type) {
+	case string:
+		return len(v)
+	case []byte:
+		return len(v)
+	case bool:
+		return 1
+	}
+	return 8
+}
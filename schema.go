@@ -0,0 +1,218 @@
+package simplets
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// the max count of primary keys allowed by tablestore
+const maxPrimaryKeys = 4
+
+// schema is the parsed ts tags of a struct type, it is cached per type so that tags are parsed only once
+type schema struct {
+	typ     reflect.Type
+	table   string
+	fields  []*schemaField // fields with ts tags, in struct order
+	pks     []*schemaField // the order of primary keys is the order of fields in struct
+	cols    []*schemaField // ts_col and ts_col_prefix fields
+	indexes []*schemaIndex // secondary indexes declared by ts_index tags, in the order they first appear
+	err     error          // *SchemaError if the tags are invalid
+
+	searchIndex  string         // name of search index, ts_search_index tag or "<table>_search"
+	searchFields []*schemaField // fields with ts_search tags
+
+	// lookups of fillStructFromRow, built once so decoding a row allocates nothing per field
+	byColumn   map[string]*schemaField // primary keys and ts_col fields by column name
+	prefixCols []*schemaField          // ts_col_prefix fields in struct order
+}
+
+// schemaIndex is a secondary index declared by ts_index tags
+type schemaIndex struct {
+	name string
+	pks  []*schemaField // the columns of index in order, the primary keys of table are appended by tablestore
+}
+
+// index returns the secondary index declared by the struct, nil if it does not exist
+func (s *schema) index(name string) *schemaIndex {
+	for _, idx := range s.indexes {
+		if idx.name == name {
+			return idx
+		}
+	}
+	return nil
+}
+
+// keys returns the primary keys of index table, which are the columns of index followed by the primary keys of table
+func (idx *schemaIndex) keys(s *schema) []*schemaField {
+	return append(append([]*schemaField(nil), idx.pks...), s.pks...)
+}
+
+type schemaField struct {
+	structFieldInfo
+	index int    // index of the field in struct
+	name  string // name of the field in struct
+	typ   reflect.Type
+}
+
+// FieldError is a violation of ts tag rules of a struct field
+type FieldError struct {
+	Field  string
+	Reason string
+}
+
+// SchemaError reports every violation of ts tag rules found in a struct type
+type SchemaError struct {
+	Type   reflect.Type
+	Errors []FieldError
+}
+
+func (e *SchemaError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "simple-tablestore: invalid ts tags of %s:", e.Type)
+	for _, fe := range e.Errors {
+		if fe.Field == "" {
+			fmt.Fprintf(&b, " %s;", fe.Reason)
+		} else {
+			fmt.Fprintf(&b, " %s: %s;", fe.Field, fe.Reason)
+		}
+	}
+	return strings.TrimSuffix(b.String(), ";")
+}
+
+var schemas sync.Map // reflect.Type -> *schema
+
+// Validate parses and checks the ts tags of a struct(or pointer to struct), it returns a *SchemaError listing every
+// violation if the tags are invalid. the result is cached, so a validated type is never parsed again
+func Validate(r interface{}) error {
+	t := reflect.TypeOf(r)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return fmt.Errorf("simple-tablestore: %T is not a struct", r)
+	}
+	return loadSchema(t).err
+}
+
+// MustRegister validates the struct types at startup and panics if any of them is invalid,
+// so that a wrong tag is found at once instead of at the first read or write
+func MustRegister(rs ...interface{}) {
+	for _, r := range rs {
+		if err := Validate(r); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func loadSchema(t reflect.Type) *schema {
+	if s, ok := schemas.Load(t); ok {
+		return s.(*schema)
+	}
+	s, _ := schemas.LoadOrStore(t, parseSchema(t))
+	return s.(*schema)
+}
+
+// getSchema returns the schema of a valid struct type, it panics if the tags are invalid, so the exported
+// functions check loadSchema(t).err or Validate first and return the *SchemaError
+func getSchema(t reflect.Type) *schema {
+	s := loadSchema(t)
+	if s.err != nil {
+		panic(s.err)
+	}
+	return s
+}
+
+func parseSchema(t reflect.Type) *schema {
+	s := &schema{typ: t}
+	var errs []FieldError
+	columns := make(map[string]string)
+	indexes := make(map[string]map[int]*schemaField)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		si, problems := getStructFieldInfo(field)
+		for _, p := range problems {
+			errs = append(errs, FieldError{Field: field.Name, Reason: p})
+		}
+		if si.tableName != "" {
+			if i != 0 {
+				errs = append(errs, FieldError{Field: field.Name, Reason: "ts_table tag must only be defined in the first field"})
+			} else {
+				s.table = si.tableName
+			}
+		}
+		if si.searchIndex != "" {
+			if i != 0 {
+				errs = append(errs, FieldError{Field: field.Name, Reason: "ts_search_index tag must only be defined in the first field"})
+			} else {
+				s.searchIndex = si.searchIndex
+			}
+		}
+		if si.fieldName == "" {
+			// this field is not relate to ts, just ignore
+			continue
+		}
+		if other, ok := columns[si.fieldName]; ok {
+			errs = append(errs, FieldError{Field: field.Name, Reason: fmt.Sprintf("column %s is also defined by %s", si.fieldName, other)})
+		}
+		columns[si.fieldName] = field.Name
+		f := &schemaField{structFieldInfo: si, index: i, name: field.Name, typ: field.Type}
+		s.fields = append(s.fields, f)
+		if si.isPk {
+			if si.isHashPk && len(s.pks) > 0 {
+				errs = append(errs, FieldError{Field: field.Name, Reason: "hash primary key must be the first primary key"})
+			}
+			if si.isAutoIncPk && len(s.pks) == 0 {
+				errs = append(errs, FieldError{Field: field.Name, Reason: "the first primary key can not be auto_inc"})
+			}
+			s.pks = append(s.pks, f)
+		} else {
+			s.cols = append(s.cols, f)
+		}
+		if si.search != nil {
+			s.searchFields = append(s.searchFields, f)
+		}
+		for _, it := range si.indexes {
+			if indexes[it.name] == nil {
+				indexes[it.name] = make(map[int]*schemaField)
+				s.indexes = append(s.indexes, &schemaIndex{name: it.name})
+			}
+			if other, ok := indexes[it.name][it.order]; ok {
+				errs = append(errs, FieldError{Field: field.Name, Reason: fmt.Sprintf("order %d of index %s is also used by %s", it.order, it.name, other.name)})
+			}
+			indexes[it.name][it.order] = f
+		}
+	}
+	for _, idx := range s.indexes {
+		for order := 1; order <= len(indexes[idx.name]); order++ {
+			f, ok := indexes[idx.name][order]
+			if !ok {
+				errs = append(errs, FieldError{Reason: fmt.Sprintf("orders of index %s must be continuous from 1", idx.name)})
+				break
+			}
+			idx.pks = append(idx.pks, f)
+		}
+	}
+	if s.table == "" {
+		errs = append(errs, FieldError{Reason: "no ts_table tag found in the first field"})
+	}
+	if s.searchIndex == "" {
+		s.searchIndex = s.table + "_search"
+	}
+	if len(s.pks) == 0 || len(s.pks) > maxPrimaryKeys {
+		errs = append(errs, FieldError{Reason: fmt.Sprintf("the count of primary keys must be in [1, %d], got %d", maxPrimaryKeys, len(s.pks))})
+	}
+	if len(errs) > 0 {
+		s.err = &SchemaError{Type: t, Errors: errs}
+	}
+	s.byColumn = make(map[string]*schemaField, len(s.fields))
+	for _, f := range s.fields {
+		if f.isPrefixCol {
+			s.prefixCols = append(s.prefixCols, f)
+		} else {
+			s.byColumn[f.fieldName] = f
+		}
+	}
+	return s
+}
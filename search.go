@@ -0,0 +1,370 @@
+package simplets
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	. "github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/otsprotocol"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/search"
+	"github.com/golang/protobuf/proto"
+)
+
+// SearchClient is the subset of tablestore search index api that simplets depends on, *TableStoreClient satisfies it.
+// like Client, it is bound to the context by ContextBinder if the client returned by WithContext implements it
+type SearchClient interface {
+	CreateSearchIndex(request *CreateSearchIndexRequest) (*CreateSearchIndexResponse, error)
+	DescribeSearchIndex(request *DescribeSearchIndexRequest) (*DescribeSearchIndexResponse, error)
+	Search(request *SearchRequest) (*SearchResponse, error)
+}
+
+var _ SearchClient = (*TableStoreClient)(nil)
+
+// bindSearchContext is bindContext for SearchClient
+func bindSearchContext(ctx context.Context, client SearchClient) (SearchClient, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if binder, ok := client.(ContextBinder); ok {
+		if bound, ok := binder.WithContext(ctx).(SearchClient); ok {
+			return bound, nil
+		}
+	}
+	return client, nil
+}
+
+// SearchIndexMismatchError is returned by EnsureSearchIndex if the search index exists but its fields do not match
+// the ts_search tags, Fields are the column names with the reasons
+type SearchIndexMismatchError struct {
+	Table  string
+	Index  string
+	Fields []FieldError
+}
+
+func (e *SearchIndexMismatchError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "simple-tablestore: search index %s of table %s does not match the struct:", e.Index, e.Table)
+	for _, fe := range e.Fields {
+		fmt.Fprintf(&b, " %s: %s;", fe.Field, fe.Reason)
+	}
+	return strings.TrimSuffix(b.String(), ";")
+}
+
+// EnsureSearchIndex makes sure the search index declared by ts_search tags of struct r exists, it is created if
+// it does not exist, otherwise a *SearchIndexMismatchError is returned if a field is missing or differs.
+// the index is named by ts_search_index tag on the first field, or "<table>_search" if the tag is absent
+func EnsureSearchIndex(client SearchClient, r interface{}) error {
+	return EnsureSearchIndexCtx(context.Background(), client, r)
+}
+
+// EnsureSearchIndexCtx is EnsureSearchIndex with a context
+func EnsureSearchIndexCtx(ctx context.Context, client SearchClient, r interface{}) error {
+	if err := Validate(r); err != nil {
+		return err
+	}
+	s := getSchema(reflect.Indirect(reflect.ValueOf(r)).Type())
+	if len(s.searchFields) == 0 {
+		return fmt.Errorf("simple-tablestore: %T has no ts_search tags", r)
+	}
+	client, err := bindSearchContext(ctx, client)
+	if err != nil {
+		return err
+	}
+	resp, err := client.DescribeSearchIndex(&DescribeSearchIndexRequest{TableName: s.table, IndexName: s.searchIndex})
+	if err != nil {
+		err = substantiateError(err)
+		if !IsObjectNotExist(err) {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		_, err = client.CreateSearchIndex(&CreateSearchIndexRequest{
+			TableName:   s.table,
+			IndexName:   s.searchIndex,
+			IndexSchema: &IndexSchema{FieldSchemas: searchFieldSchemas(s)},
+		})
+		return substantiateError(err)
+	}
+	return matchSearchFields(s, resp.Schema)
+}
+
+func searchFieldSchemas(s *schema) []*FieldSchema {
+	var schemas []*FieldSchema
+	for _, f := range s.searchFields {
+		name := f.fieldName
+		index := true
+		fs := &FieldSchema{FieldName: &name, FieldType: f.search.fieldType, Index: &index}
+		if f.search.analyzer != "" {
+			analyzer := f.search.analyzer
+			fs.Analyzer = &analyzer
+		}
+		if f.search.fieldType != FieldType_TEXT {
+			sortAndAgg := f.search.sortAndAgg
+			fs.EnableSortAndAgg = &sortAndAgg
+		}
+		if f.search.isArray {
+			isArray := true
+			fs.IsArray = &isArray
+		}
+		schemas = append(schemas, fs)
+	}
+	return schemas
+}
+
+func matchSearchFields(s *schema, indexSchema *IndexSchema) error {
+	actual := make(map[string]*FieldSchema)
+	if indexSchema != nil {
+		for _, fs := range indexSchema.FieldSchemas {
+			actual[*fs.FieldName] = fs
+		}
+	}
+	e := &SearchIndexMismatchError{Table: s.table, Index: s.searchIndex}
+	for _, f := range s.searchFields {
+		st := f.search
+		fs, ok := actual[f.fieldName]
+		var reason string
+		switch {
+		case !ok:
+			reason = "not found in search index"
+		case fs.FieldType != st.fieldType:
+			reason = fmt.Sprintf("expect type %s, got %s", searchFieldTypeNames[st.fieldType], searchFieldTypeNames[fs.FieldType])
+		case st.analyzer != "" && (fs.Analyzer == nil || *fs.Analyzer != st.analyzer):
+			reason = fmt.Sprintf("expect analyzer %s", st.analyzer)
+		case st.sortAndAgg && (fs.EnableSortAndAgg == nil || !*fs.EnableSortAndAgg):
+			reason = "sorting and aggregation are not enabled"
+		case st.isArray != (fs.IsArray != nil && *fs.IsArray):
+			reason = fmt.Sprintf("expect array %v", st.isArray)
+		default:
+			continue
+		}
+		e.Fields = append(e.Fields, FieldError{Field: f.fieldName, Reason: reason})
+	}
+	if len(e.Fields) > 0 {
+		return e
+	}
+	return nil
+}
+
+// SearchResult is the result of Search besides the rows
+type SearchResult struct {
+	// TotalCount is the count of all matched rows, it is -1 unless the query sets GetTotalCount
+	TotalCount int64
+	// NextToken is used to get the next page by search.SearchQuery.SetToken, nil if there are no more rows
+	NextToken    []byte
+	IsAllSuccess bool
+}
+
+// Search queries the search index declared by the element type of dst, the matched rows are decoded into dst,
+// which must be a pointer to a slice of struct or struct pointer, e.g. &[]T{} or &[]*T{}.
+// query is either a *Query, which is built for the element type of dst, or a query of the sdk wrapped by SDKQuery.
+// all the columns are returned, a column not stored in the search index is read from table
+func Search(client SearchClient, dst interface{}, query SearchQuery) (*SearchResult, error) {
+	return SearchCtx(context.Background(), client, dst, query)
+}
+
+// SearchCtx is Search with a context
+func SearchCtx(ctx context.Context, client SearchClient, dst interface{}, query SearchQuery) (*SearchResult, error) {
+	slice, elem, err := sliceOf(dst)
+	if err != nil {
+		return nil, err
+	}
+	s := getSchema(elem)
+	req, err := searchRequest(s, query)
+	if err != nil {
+		return nil, err
+	}
+	client, err = bindSearchContext(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Search(req)
+	if err != nil {
+		return nil, substantiateError(err)
+	}
+	slice.Set(reflect.MakeSlice(slice.Type(), 0, len(resp.Rows)))
+	for _, row := range resp.Rows {
+		appendRow(slice, row)
+	}
+	return &SearchResult{TotalCount: resp.TotalCount, NextToken: resp.NextToken, IsAllSuccess: resp.IsAllSuccess}, nil
+}
+
+func searchRequest(s *schema, query SearchQuery) (*SearchRequest, error) {
+	if query == nil {
+		return nil, errors.New("simple-tablestore: search query is nil")
+	}
+	sq, err := query.searchQuery(s)
+	if err != nil {
+		return nil, err
+	}
+	return &SearchRequest{
+		TableName:    s.table,
+		IndexName:    s.searchIndex,
+		SearchQuery:  sq,
+		ColumnsToGet: &ColumnsToGet{ReturnAll: true},
+	}, nil
+}
+
+// SearchRows iterates the rows matched by a search query like Rows, the next page is fetched by NextToken
+// once the current one is scanned. the page size is the limit of query
+type SearchRows struct {
+	client SearchClient
+	s      *schema
+	query  SearchQuery
+	err    error
+
+	token   []byte // token of the current page, nil for the first page
+	next    []byte // NextToken of the current page
+	fetched bool
+	skip    int // rows of the first page skipped when resumed by a cursor
+
+	cursor int
+	rows   []*Row
+}
+
+// searchCursor is the position of SearchRows, the rows before Skip of the page fetched by Token are scanned
+type searchCursor struct {
+	Token []byte `json:"t,omitempty"`
+	Skip  int    `json:"s,omitempty"`
+}
+
+// SearchIter returns the rows matched by query on the search index declared by struct r, the rows are scanned
+// into the type of r. query is a *Query or a query of the sdk wrapped by SDKQuery, it must not be paged by a
+// token already
+func SearchIter(client SearchClient, r interface{}, query SearchQuery) *SearchRows {
+	i := &SearchRows{client: client, query: query}
+	if i.err = Validate(r); i.err == nil {
+		i.s = getSchema(reflect.Indirect(reflect.ValueOf(r)).Type())
+	}
+	return i
+}
+
+// ResumeSearch is SearchIter starting at cursor returned by SearchRows.Cursor of the same query,
+// it starts at the first row if cursor is empty
+func ResumeSearch(client SearchClient, r interface{}, query SearchQuery, cursor string) (*SearchRows, error) {
+	i := SearchIter(client, r, query)
+	if i.err != nil {
+		return nil, i.err
+	}
+	if cursor == "" {
+		return i, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("simple-tablestore: invalid search cursor: %v", err)
+	}
+	var c searchCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Skip < 0 {
+		return nil, errors.New("simple-tablestore: invalid search cursor")
+	}
+	i.token, i.skip = c.Token, c.Skip
+	return i, nil
+}
+
+// Cursor returns an opaque position of the rows which is safe to hand to a client, ResumeSearch continues
+// at the row following the last scanned one. an empty cursor is returned after all the rows are scanned
+func (i *SearchRows) Cursor() string {
+	c := searchCursor{Token: i.token, Skip: i.skip}
+	if i.fetched {
+		c.Skip = i.cursor
+		if i.cursor == len(i.rows) {
+			if i.next == nil {
+				return ""
+			}
+			c = searchCursor{Token: i.next}
+		}
+	}
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Scan scans the next row into r, ErrRangeEnd is returned if there are no more rows
+func (i *SearchRows) Scan(r interface{}) error {
+	return i.ScanCtx(context.Background(), r)
+}
+
+// ScanCtx is Scan with a context, it returns ctx.Err() once ctx is done, the next page is not fetched then
+func (i *SearchRows) ScanCtx(ctx context.Context, r interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := loadSchema(reflect.TypeOf(r).Elem()).err; err != nil {
+		return err
+	}
+	if i.err != nil {
+		return i.err
+	}
+	for i.cursor == len(i.rows) {
+		if i.fetched && i.next == nil {
+			return ErrRangeEnd
+		}
+		if err := i.fetch(ctx); err != nil {
+			return err
+		}
+	}
+	fillStructFromRow(reflect.ValueOf(r).Elem(), i.rows[i.cursor])
+	i.cursor++
+	return nil
+}
+
+func (i *SearchRows) fetch(ctx context.Context) error {
+	token := i.token
+	if i.fetched {
+		token = i.next
+	}
+	req, err := searchRequest(i.s, i.query)
+	if err != nil {
+		return err
+	}
+	if token != nil {
+		// the sort and offset are kept by the token
+		req.SearchQuery = &editedQuery{query: req.SearchQuery, edit: func(pb *otsprotocol.SearchQuery) error {
+			pb.Token, pb.Sort, pb.Offset = token, nil, nil
+			return nil
+		}}
+	}
+	client, err := bindSearchContext(ctx, i.client)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Search(req)
+	if err != nil {
+		return substantiateError(err)
+	}
+	i.token, i.next, i.fetched = token, resp.NextToken, true
+	i.rows, i.cursor = resp.Rows, 0
+	if i.skip > 0 {
+		i.cursor = i.skip
+		if i.cursor > len(i.rows) {
+			i.cursor = len(i.rows)
+		}
+		i.skip = 0
+	}
+	return nil
+}
+
+// editedQuery is query whose protobuf is modified by edit before sending
+type editedQuery struct {
+	query search.SearchQuery
+	edit  func(pb *otsprotocol.SearchQuery) error
+}
+
+func (q *editedQuery) Serialize() ([]byte, error) {
+	data, err := q.query.Serialize()
+	if err != nil {
+		return nil, err
+	}
+	pb := new(otsprotocol.SearchQuery)
+	if err := proto.Unmarshal(data, pb); err != nil {
+		return nil, err
+	}
+	if err := q.edit(pb); err != nil {
+		return nil, err
+	}
+	return proto.Marshal(pb)
+}
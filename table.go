@@ -0,0 +1,173 @@
+package simplets
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	. "github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+)
+
+// Table is the typed repository of the table of struct T, the tags of T are checked once by NewTable, so the
+// rows passed to and returned by its methods are always of the right type. the methods call GetRow, PutRow and
+// so on, and accept the same options
+type Table[T any] struct {
+	client Client
+}
+
+// NewTable returns the repository of T, which must be a struct with valid ts tags
+func NewTable[T any](client Client) (*Table[T], error) {
+	if t := reflect.TypeOf((*T)(nil)).Elem(); t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("simple-tablestore: %s is not a struct", t)
+	}
+	if err := Validate(new(T)); err != nil {
+		return nil, err
+	}
+	return &Table[T]{client: client}, nil
+}
+
+// Get reads the row whose primary keys are the primary key fields of key, ok is false if the row does not exist
+func (t *Table[T]) Get(key T, setters ...Option) (r T, ok bool, err error) {
+	return t.GetCtx(context.Background(), key, setters...)
+}
+
+// GetCtx is Get with a context
+func (t *Table[T]) GetCtx(ctx context.Context, key T, setters ...Option) (r T, ok bool, err error) {
+	r = keyOf(key)
+	ok, err = GetRowCtx(ctx, t.client, &r, setters...)
+	return r, ok, err
+}
+
+// Put writes r like PutRow, auto increment primary keys are filled back to r
+func (t *Table[T]) Put(r *T, setters ...Option) error {
+	return PutRowCtx(context.Background(), t.client, r, setters...)
+}
+
+// PutCtx is Put with a context
+func (t *Table[T]) PutCtx(ctx context.Context, r *T, setters ...Option) error {
+	return PutRowCtx(ctx, t.client, r, setters...)
+}
+
+// Update writes r like UpdateRow, the values of atomic increment columns are filled back to r
+func (t *Table[T]) Update(r *T, setters ...Option) error {
+	return UpdateRowCtx(context.Background(), t.client, r, setters...)
+}
+
+// UpdateCtx is Update with a context
+func (t *Table[T]) UpdateCtx(ctx context.Context, r *T, setters ...Option) error {
+	return UpdateRowCtx(ctx, t.client, r, setters...)
+}
+
+// Delete deletes the row whose primary keys are the primary key fields of key
+func (t *Table[T]) Delete(key T, setters ...Option) error {
+	return DeleteRowCtx(context.Background(), t.client, &key, setters...)
+}
+
+// DeleteCtx is Delete with a context
+func (t *Table[T]) DeleteCtx(ctx context.Context, key T, setters ...Option) error {
+	return DeleteRowCtx(ctx, t.client, &key, setters...)
+}
+
+// BatchGet reads the rows of keys like BatchGetRows, rs[i] is the row of keys[i] and exists[i] reports whether
+// it is found. rs[i] has only the primary keys of keys[i] if the row does not exist
+func (t *Table[T]) BatchGet(keys []T, setters ...Option) (rs []T, exists []bool, err error) {
+	return t.BatchGetCtx(context.Background(), keys, setters...)
+}
+
+// BatchGetCtx is BatchGet with a context
+func (t *Table[T]) BatchGetCtx(ctx context.Context, keys []T, setters ...Option) (rs []T, exists []bool, err error) {
+	rs = make([]T, len(keys))
+	ptrs := make([]interface{}, len(keys))
+	for i := range keys {
+		rs[i] = keyOf(keys[i])
+		ptrs[i] = &rs[i]
+	}
+	exists, err = BatchGetRowsCtx(ctx, t.client, ptrs, setters...)
+	return rs, exists, err
+}
+
+// keyOf returns a T with only the primary key fields of key, so the row read into it does not share the maps and
+// slices of the other fields of key
+func keyOf[T any](key T) T {
+	var r T
+	src, dst := reflect.ValueOf(&key).Elem(), reflect.ValueOf(&r).Elem()
+	for _, f := range getSchema(dst.Type()).pks {
+		dst.Field(f.index).Set(src.Field(f.index))
+	}
+	return r
+}
+
+// Range reads the rows from froms to tos like Range, but returns the error of invalid keys or options at once
+func (t *Table[T]) Range(froms, tos []interface{}, direction Direction, total int32, setters ...Option) (*TableRows[T], error) {
+	s := getSchema(reflect.TypeOf((*T)(nil)).Elem())
+	rows, err := newRangeRows(t.client, s, s.table, s.pks, froms, tos, direction, total, setters)
+	if err != nil {
+		return nil, err
+	}
+	return &TableRows[T]{rows: rows}, nil
+}
+
+// TableRows iterates the rows of Table.Range
+//
+//	for rows.Next() {
+//		r := rows.Row()
+//		...
+//	}
+//	if err := rows.Err(); err != nil {
+//		...
+//	}
+type TableRows[T any] struct {
+	rows *Rows
+	row  T
+}
+
+// Next fetches the next row, it returns false if there are no more rows, an error occurs or TableRows is closed
+func (i *TableRows[T]) Next() bool {
+	return i.NextCtx(context.Background())
+}
+
+// NextCtx is Next with a context, Err returns ctx.Err() if ctx is done
+func (i *TableRows[T]) NextCtx(ctx context.Context) bool {
+	var zero T
+	i.row = zero
+	if !i.rows.NextCtx(ctx) {
+		return false
+	}
+	if err := i.rows.Scan(&i.row); err != nil {
+		i.rows.err = err
+		return false
+	}
+	return true
+}
+
+// Row returns the row fetched by the last Next
+func (i *TableRows[T]) Row() T {
+	return i.row
+}
+
+// Err returns the error stopping Next
+func (i *TableRows[T]) Err() error {
+	return i.rows.Err()
+}
+
+// Close stops the scan like Rows.Close
+func (i *TableRows[T]) Close() error {
+	return i.rows.Close()
+}
+
+// Cursor returns the position after the last row read, see Rows.Cursor
+func (i *TableRows[T]) Cursor() string {
+	return i.rows.Cursor()
+}
+
+// All returns the rows not read yet, the rows read before an error are returned with it
+func (i *TableRows[T]) All() ([]T, error) {
+	return i.AllCtx(context.Background())
+}
+
+// AllCtx is All with a context
+func (i *TableRows[T]) AllCtx(ctx context.Context) ([]T, error) {
+	var rs []T
+	err := ScanAllCtx(ctx, i.rows, &rs)
+	return rs, err
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 
 	. "github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
@@ -20,157 +21,99 @@ func trimHashPrefix(str string) string {
 	return str[4+len("..."):]
 }
 
-func IsObjectNotExist(err error) bool {
-	return strings.Contains(err.Error(), "OTSObjectNotExist")
-}
-
-func IsConditionCheckFail(err error) bool {
-	return strings.Contains(err.Error(), "OTSConditionCheckFail")
-}
-
-func substantiateError(err error) error {
-	if IsObjectNotExist(err) {
-		return fmt.Errorf("err is %w: %v", ErrObjectNotExist, err)
-	}
-	if IsConditionCheckFail(err) {
-		return fmt.Errorf("err is %w: %v", ErrConditionCheckFail, err)
-	}
-	return err
-}
-
 var typeOfBytes = reflect.TypeOf([]byte(nil))
 
 type fieldInfo struct {
-	structFieldInfo
+	*schemaField
 	kind   reflect.Kind
 	value  interface{}
 	isZero bool
 	values map[string]interface{} // for prefix field
 }
 
-func fillStructFromFields(t reflect.Type, v reflect.Value, fields map[string]*fieldInfo) {
-	for i := 0; i < t.NumField(); i++ {
-		value := v.Field(i)
-		field := t.Field(i)
-		si := getStructFieldInfo(field)
-		fieldInfo, ok := fields[si.fieldName]
-		if !ok {
-			continue
-		}
+func fillStructFromFields(v reflect.Value, fields map[string]*fieldInfo) {
+	for _, fieldInfo := range fields {
+		value := v.Field(fieldInfo.index)
 		if fieldInfo.isPrefixCol {
-			if value.Kind() != reflect.Map { //todo failfast in Check function if kind is not map
-				continue
-			}
-			valueType := value.Type().Elem()
-			if value.IsNil() {
-				value.Set(reflect.MakeMap(value.Type()))
-			}
+			makeMapIfNil(value)
 			for k, v := range fieldInfo.values {
-				k1 := reflect.ValueOf(k)
-				v1 := reflect.ValueOf(v)
-				// we must ensure the field type in table is same as type defined in struct, otherwise, it will panic
-				if valueType.Kind() == v1.Type().Kind() || valueType.Kind() == reflect.Interface {
-					if v1.Interface() != nil {
-						value.SetMapIndex(k1, v1)
-					}
-				}
+				setMapValue(value, k, v)
 			}
 		} else {
-			// we can't simply value.Set(reflect.ValueOf(structFieldInfo.value)) because if the field type in table is not match our type
-			// defined in struct, it will panic
-			if value.Kind() == reflect.ValueOf(fieldInfo.value).Kind() || value.Kind() == reflect.Interface {
-				if fieldInfo.value != nil {
-					value.Set(reflect.ValueOf(fieldInfo.value))
-				}
-			}
+			setFieldValue(value, fieldInfo.value)
 		}
 	}
 }
 
-func getTableInfoFromStruct(r interface{}) (table string, pkFields, colFields []*fieldInfo) {
-	v := reflect.ValueOf(r).Elem()
-	t := v.Type()
+// setFieldValue sets the struct field to the column value x, it is skipped if x is nil or the field type does not
+// match the type in table, which would panic
+func setFieldValue(field reflect.Value, x interface{}) {
+	if x == nil {
+		return
+	}
+	if v := reflect.ValueOf(x); field.Kind() == v.Kind() || field.Kind() == reflect.Interface {
+		field.Set(v)
+	}
+}
 
-	for i := 0; i < t.NumField(); i++ {
-		value := v.Field(i)
-		kind := value.Kind()
-		si := getStructFieldInfo(t.Field(i))
-		if si.tableName != "" {
-			table = si.tableName
-		}
-		if si.fieldName == "" {
-			continue
-		}
-		f := &fieldInfo{
-			structFieldInfo: si,
-			kind:            kind,
-			value:           value.Interface(),
-			isZero:          value.IsZero(),
-		}
-		if f.isPk {
-			pkFields = append(pkFields, f)
-		} else {
-			colFields = append(colFields, f)
+// setMapValue sets key of the ts_col_prefix field to the column value x like setFieldValue
+func setMapValue(field reflect.Value, key string, x interface{}) {
+	if x == nil {
+		return
+	}
+	if v, elem := reflect.ValueOf(x), field.Type().Elem(); elem.Kind() == v.Kind() || elem.Kind() == reflect.Interface {
+		field.SetMapIndex(reflect.ValueOf(key), v)
+	}
+}
+
+func makeMapIfNil(field reflect.Value) {
+	if field.IsNil() {
+		field.Set(reflect.MakeMap(field.Type()))
+	}
+}
+
+func newFieldInfo(sf *schemaField, value reflect.Value) *fieldInfo {
+	f := &fieldInfo{
+		schemaField: sf,
+		kind:        value.Kind(),
+		value:       value.Interface(),
+		isZero:      value.IsZero(),
+	}
+	if f.isPrefixCol {
+		values := make(map[string]interface{}, value.Len())
+		iter := value.MapRange()
+		for iter.Next() {
+			values[iter.Key().String()] = iter.Value().Interface()
 		}
+		f.values = values
 	}
-	if table == "" {
-		panic("no ts_table tag found")
+	return f
+}
+
+// generateFields returns the field infos of struct value v keyed by column name(or prefix)
+func generateFields(v reflect.Value, s *schema) map[string]*fieldInfo {
+	fields := make(map[string]*fieldInfo, len(s.fields))
+	for _, sf := range s.fields {
+		fields[sf.fieldName] = newFieldInfo(sf, v.Field(sf.index))
 	}
-	return
+	return fields
 }
 
 func generateInfo(v reflect.Value, t reflect.Type) (*PrimaryKey, map[string]*fieldInfo, string) {
-	table := ""
+	s := getSchema(t)
 	pk := new(PrimaryKey)
-	fields := make(map[string]*fieldInfo)
-	for i := 0; i < t.NumField(); i++ {
-		value := v.Field(i)
-		kind := value.Kind()
-		si := getStructFieldInfo(t.Field(i))
-		if si.tableName != "" {
-			table = si.tableName
-		}
-		if si.fieldName == "" {
-			// this field is not relate to ts, just ignore
-			continue
-		}
-		//if !value.IsZero() && si.isAutoIncPk {
-		//	panic("autoInc pk do not accept any value")
-		//}
-		//todo: make sure the struct field type is bool int64 string float []byte, otherwise fail fast
-		v := value.Interface()
-		f := &fieldInfo{
-			structFieldInfo: si,
-			kind:            kind,
-			value:           v,
-			isZero:          value.IsZero(),
-		}
-		if f.isPrefixCol {
-			if kind != reflect.Map {
-				panic("ts_col_prefix field must be a map")
-			}
-			values := make(map[string]interface{})
-			iter := value.MapRange()
-			for iter.Next() {
-				k := iter.Key()
-				v := iter.Value()
-				values[k.String()] = v.Interface()
-			}
-			f.values = values
-		}
-		fields[si.fieldName] = f
-		if !si.isPk {
-			continue
-		}
-		if si.isHashPk {
-			pk.AddPrimaryKeyColumn(si.fieldName, addHashPrefix(v.(string)))
-		} else if si.isAutoIncPk && value.IsZero() {
-			pk.AddPrimaryKeyColumnWithAutoIncrement(si.fieldName)
+	fields := generateFields(v, s)
+	for _, sf := range s.pks {
+		f := fields[sf.fieldName]
+		if sf.isHashPk {
+			pk.AddPrimaryKeyColumn(sf.fieldName, addHashPrefix(f.value.(string)))
+		} else if sf.isAutoIncPk && f.isZero {
+			pk.AddPrimaryKeyColumnWithAutoIncrement(sf.fieldName)
 		} else {
-			pk.AddPrimaryKeyColumn(si.fieldName, v)
+			pk.AddPrimaryKeyColumn(sf.fieldName, f.value)
 		}
 	}
-	return pk, fields, table
+	return pk, fields, s.table
 }
 
 type structFieldInfo struct {
@@ -181,72 +124,262 @@ type structFieldInfo struct {
 	isAutoIncPk    bool
 	isPrefixCol    bool
 	isAtomicIncCol bool
+	isDefinedCol   bool
 	columnPrefix   string
+	indexes        []indexTag
+	searchIndex    string
+	search         *searchTag
+}
+
+// indexTag is a secondary index which a column belongs to, order is the 1-based position of the column
+// in the primary keys of index
+type indexTag struct {
+	name  string
+	order int
+}
+
+// parseTag splits a ts tag into the column name and its options, unknown options are reported as problems
+func parseTag(tag, tagName string, allowed ...string) (name string, options map[string]bool, problems []string) {
+	splits := strings.Split(tag, ",")
+	name = strings.TrimSpace(splits[0])
+	if name == "" {
+		problems = append(problems, fmt.Sprintf("%s tag has an empty column name", tagName))
+	}
+	options = make(map[string]bool)
+	for _, option := range splits[1:] {
+		option = strings.TrimSpace(option)
+		known := false
+		for _, a := range allowed {
+			if option == a {
+				known = true
+			}
+		}
+		if !known {
+			problems = append(problems, fmt.Sprintf("unknown option %q of %s tag", option, tagName))
+			continue
+		}
+		options[option] = true
+	}
+	return
 }
 
 //Pk1  string           `ts_pk:"pk1,hash" ts_table:"test_auto_inc"`
 //Pk2  int64            `ts_pk:"pk2,auto_inc"`
 //ColAny int64            `ts_col:"col1,atomic"`
+//Email string            `ts_col:"email,defined"`
+//Name  string            `ts_col:"name" ts_index:"idx_by_name,1"`
+//Title string            `ts_col:"title" ts_search:"text,analyzer=single_word"`
 //ColsAtomic map[string]int64 `ts_col_prefix:"c_,atomic"`
-func getStructFieldInfo(field reflect.StructField) structFieldInfo {
-	pkStr := field.Tag.Get("ts_pk")
-	colStr := field.Tag.Get("ts_col")
-	colPrefixStr := field.Tag.Get("ts_col_prefix")
-	info := structFieldInfo{}
-	if pkStr != "" {
-		splits := strings.Split(pkStr, ",")
-		pkName := splits[0]
-		isHashPk := strings.Contains(pkStr, "hash")
-		isAutoIncPk := strings.Contains(pkStr, "auto_inc")
-		tabName := field.Tag.Get("ts_table")
-		info = structFieldInfo{
-			tableName:   tabName,
-			fieldName:   pkName,
-			isPk:        true,
-			isHashPk:    isHashPk,
-			isAutoIncPk: isAutoIncPk,
-		}
-	} else if colStr != "" {
-		splits := strings.Split(colStr, ",")
-		colName := splits[0]
-		isAtomicIncCol := strings.Contains(colStr, "atomic")
-		info = structFieldInfo{
-			fieldName:      colName,
-			isAtomicIncCol: isAtomicIncCol,
-		}
-	} else if colPrefixStr != "" {
-		splits := strings.Split(colPrefixStr, ",")
-		colName := splits[0]
-		isAtomicIncCol := strings.Contains(colPrefixStr, "atomic")
-		info = structFieldInfo{
-			fieldName:      colName,
-			isAtomicIncCol: isAtomicIncCol,
-			isPrefixCol:    true,
-			columnPrefix:   colName,
-		}
-
-	} else {
-		info = structFieldInfo{}
-	}
-
-	//todo: 1. hash must be first field, 2. cannot isHashPk and isAutoIncPk simultaneously
-	//todo: ensure field type is int64/bytes/string/float64
-	//todo 3. panic("table tag must only be defined in first field")
+func getStructFieldInfo(field reflect.StructField) (info structFieldInfo, problems []string) {
+	pkStr, isPk := field.Tag.Lookup("ts_pk")
+	colStr, isCol := field.Tag.Lookup("ts_col")
+	colPrefixStr, isPrefixCol := field.Tag.Lookup("ts_col_prefix")
+	info.tableName = field.Tag.Get("ts_table")
+	info.searchIndex = field.Tag.Get("ts_search_index")
+	count := 0
+	for _, b := range []bool{isPk, isCol, isPrefixCol} {
+		if b {
+			count++
+		}
+	}
+	if count > 1 {
+		problems = append(problems, "only one of ts_pk, ts_col and ts_col_prefix tags can be defined")
+	}
+	var name string
+	var options map[string]bool
+	var tagProblems []string
+	if isPk {
+		name, options, tagProblems = parseTag(pkStr, "ts_pk", "hash", "auto_inc")
+		info.fieldName = name
+		info.isPk = true
+		info.isHashPk = options["hash"]
+		info.isAutoIncPk = options["auto_inc"]
+	} else if isCol {
+		name, options, tagProblems = parseTag(colStr, "ts_col", "atomic", "defined")
+		info.fieldName = name
+		info.isAtomicIncCol = options["atomic"]
+		info.isDefinedCol = options["defined"]
+	} else if isPrefixCol {
+		name, options, tagProblems = parseTag(colPrefixStr, "ts_col_prefix", "atomic")
+		info.fieldName = name
+		info.isAtomicIncCol = options["atomic"]
+		info.isPrefixCol = true
+		info.columnPrefix = name
+	}
+	problems = append(problems, tagProblems...)
+	if indexStr, ok := field.Tag.Lookup("ts_index"); ok {
+		if !isCol {
+			problems = append(problems, "ts_index tag can only be defined on ts_col fields")
+		}
+		info.indexes, tagProblems = parseIndexTag(indexStr)
+		problems = append(problems, tagProblems...)
+		info.isDefinedCol = true
+	}
+	if searchStr, ok := field.Tag.Lookup("ts_search"); ok {
+		if !isPk && !isCol {
+			problems = append(problems, "ts_search tag can only be defined on ts_pk and ts_col fields")
+		}
+		info.search, tagProblems = parseSearchTag(searchStr)
+		problems = append(problems, tagProblems...)
+	}
+	if info.fieldName == "" {
+		return info, problems
+	}
 
+	typ := field.Type
+	if info.isHashPk && info.isAutoIncPk {
+		problems = append(problems, "hash and auto_inc can not be used together")
+	}
+	if info.isHashPk && typ.Kind() != reflect.String {
+		problems = append(problems, "hash primary key type must be string")
+	}
+	if info.isAutoIncPk && typ.Kind() != reflect.Int64 {
+		problems = append(problems, "auto_inc primary key type must be int64")
+	}
+	if info.isPk && !info.isHashPk && !info.isAutoIncPk && !isPrimaryKeyType(typ) {
+		problems = append(problems, fmt.Sprintf("primary key type must be string, int64 or []byte, not %s", typ))
+	}
+	if info.isPrefixCol {
+		if typ.Kind() != reflect.Map || typ.Key().Kind() != reflect.String {
+			problems = append(problems, fmt.Sprintf("ts_col_prefix field must be a map with string key, not %s", typ))
+		} else if !isColumnType(typ.Elem()) {
+			problems = append(problems, fmt.Sprintf("column type must be bool, int64, string, float64, []byte or interface{}, not %s", typ.Elem()))
+		}
+	}
+	if !info.isPk && !info.isPrefixCol && !isColumnType(typ) {
+		problems = append(problems, fmt.Sprintf("column type must be bool, int64, string, float64, []byte or interface{}, not %s", typ))
+	}
+	if len(info.indexes) > 0 && !isPrimaryKeyType(typ) {
+		problems = append(problems, fmt.Sprintf("index column type must be string, int64 or []byte, not %s", typ))
+	} else if info.isDefinedCol && typ.Kind() == reflect.Interface {
+		problems = append(problems, "defined column type must be bool, int64, string, float64 or []byte")
+	}
+	if info.search != nil {
+		if info.isHashPk {
+			problems = append(problems, "ts_search tag can not be defined on hash primary key")
+		}
+		if info.search.isArray && typ.Kind() != reflect.String {
+			problems = append(problems, "search array field type must be string of json array")
+		}
+		if !info.search.isArray && typ.Kind() != searchFieldKinds[info.search.fieldType] {
+			problems = append(problems, fmt.Sprintf("search field type of %s must be %s, not %s",
+				searchFieldTypeNames[info.search.fieldType], searchFieldKinds[info.search.fieldType], typ))
+		}
+	}
 	if info.isAtomicIncCol {
-		kind := field.Type.Kind()
-		if kind != reflect.Int64 && kind != reflect.Map {
-			panic("atomic increment column type must be int64")
-		}
-		if kind == reflect.Map {
-			elemKind := field.Type.Elem().Kind()
-			if elemKind != reflect.Int64 {
-				panic("atomic increment column type must be int64")
+		if (typ.Kind() == reflect.Map && typ.Elem().Kind() != reflect.Int64) || (typ.Kind() != reflect.Map && typ.Kind() != reflect.Int64) {
+			problems = append(problems, "atomic increment column type must be int64")
+		}
+	}
+	return info, problems
+}
+
+// parseIndexTag parses ts_index tag like "idx_by_email,1", a column in several indexes is separated by ";",
+// e.g. "idx_by_email,1;idx_by_name_email,2"
+func parseIndexTag(tag string) (indexes []indexTag, problems []string) {
+	for _, item := range strings.Split(tag, ";") {
+		splits := strings.Split(item, ",")
+		name := strings.TrimSpace(splits[0])
+		if name == "" {
+			problems = append(problems, "ts_index tag has an empty index name")
+			continue
+		}
+		if len(splits) != 2 {
+			problems = append(problems, fmt.Sprintf("ts_index tag of %s must be \"name,order\"", name))
+			continue
+		}
+		order, err := strconv.Atoi(strings.TrimSpace(splits[1]))
+		if err != nil || order < 1 {
+			problems = append(problems, fmt.Sprintf("order of index %s must be a positive integer, not %q", name, splits[1]))
+			continue
+		}
+		indexes = append(indexes, indexTag{name: name, order: order})
+	}
+	return
+}
+
+// searchTag is the field schema of search index declared by ts_search tag
+type searchTag struct {
+	fieldType  FieldType
+	analyzer   Analyzer
+	sortAndAgg bool
+	isArray    bool
+}
+
+var searchFieldTypeNames = map[FieldType]string{
+	FieldType_KEYWORD:   "keyword",
+	FieldType_TEXT:      "text",
+	FieldType_LONG:      "long",
+	FieldType_DOUBLE:    "double",
+	FieldType_BOOLEAN:   "boolean",
+	FieldType_GEO_POINT: "geo_point",
+}
+
+// searchFieldKinds is the kind of struct field of each search field type
+var searchFieldKinds = map[FieldType]reflect.Kind{
+	FieldType_KEYWORD:   reflect.String,
+	FieldType_TEXT:      reflect.String,
+	FieldType_LONG:      reflect.Int64,
+	FieldType_DOUBLE:    reflect.Float64,
+	FieldType_BOOLEAN:   reflect.Bool,
+	FieldType_GEO_POINT: reflect.String,
+}
+
+// parseSearchTag parses ts_search tag like "keyword", "text,analyzer=single_word" or "long,sort".
+// options: analyzer=<single_word|max_word|min_word|split|fuzzy> for text, sort to enable sorting and aggregation,
+// array for a string column holding a json array
+func parseSearchTag(tag string) (st *searchTag, problems []string) {
+	splits := strings.Split(tag, ",")
+	name := strings.TrimSpace(splits[0])
+	st = &searchTag{}
+	found := false
+	for t, n := range searchFieldTypeNames {
+		if n == name {
+			st.fieldType, found = t, true
+		}
+	}
+	if !found {
+		return nil, []string{fmt.Sprintf("unknown search field type %q of ts_search tag", name)}
+	}
+	for _, option := range splits[1:] {
+		option = strings.TrimSpace(option)
+		switch {
+		case option == "sort":
+			st.sortAndAgg = true
+		case option == "array":
+			st.isArray = true
+		case strings.HasPrefix(option, "analyzer="):
+			st.analyzer = Analyzer(strings.TrimPrefix(option, "analyzer="))
+			switch st.analyzer {
+			case Analyzer_SingleWord, Analyzer_MaxWord, Analyzer_MinWord, Analyzer_Split, Analyzer_Fuzzy:
+			default:
+				problems = append(problems, fmt.Sprintf("unknown analyzer %q of ts_search tag", st.analyzer))
 			}
+		default:
+			problems = append(problems, fmt.Sprintf("unknown option %q of ts_search tag", option))
 		}
 	}
+	if st.analyzer != "" && st.fieldType != FieldType_TEXT {
+		problems = append(problems, "analyzer of ts_search tag is only allowed for text")
+	}
+	if st.sortAndAgg && st.fieldType == FieldType_TEXT {
+		problems = append(problems, "text of ts_search tag can not be sorted")
+	}
+	return
+}
 
-	return info
+func isPrimaryKeyType(t reflect.Type) bool {
+	return t.Kind() == reflect.String || t.Kind() == reflect.Int64 || t == typeOfBytes
+}
+
+func isColumnType(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int64, reflect.String, reflect.Float64:
+		return true
+	case reflect.Interface:
+		return t.NumMethod() == 0
+	}
+	return t == typeOfBytes
 }
 
 func getKnownPrefixFieldOfColumn(fields map[string]*fieldInfo, col string) (*fieldInfo, string) {
@@ -275,6 +408,38 @@ func fillColsToFieldInfos(columns []*AttributeColumn, fields map[string]*fieldIn
 	}
 }
 
+// fillStructFromRow decodes a row read from table, index or search index into the struct v, the fields are
+// looked up by the column lookups of schema instead of the field infos, which are built for every row
+func fillStructFromRow(v reflect.Value, row *Row) {
+	s := getSchema(v.Type())
+	for _, f := range s.prefixCols {
+		makeMapIfNil(v.Field(f.index))
+	}
+	for _, key := range row.PrimaryKey.PrimaryKeys {
+		f := s.byColumn[key.ColumnName]
+		if f == nil {
+			continue
+		}
+		if f.isHashPk {
+			setFieldValue(v.Field(f.index), trimHashPrefix(key.Value.(string)))
+		} else {
+			setFieldValue(v.Field(f.index), key.Value)
+		}
+	}
+	for _, column := range row.Columns {
+		if f, ok := s.byColumn[column.ColumnName]; ok {
+			setFieldValue(v.Field(f.index), column.Value)
+			continue
+		}
+		for _, f := range s.prefixCols {
+			if strings.HasPrefix(column.ColumnName, f.columnPrefix) {
+				setMapValue(v.Field(f.index), strings.TrimPrefix(column.ColumnName, f.columnPrefix), column.Value)
+				break
+			}
+		}
+	}
+}
+
 func fillPKsToFieldInfos(primaryKey PrimaryKey, fields map[string]*fieldInfo) {
 	for _, key := range primaryKey.PrimaryKeys {
 		field := fields[key.ColumnName]
@@ -285,3 +450,124 @@ func fillPKsToFieldInfos(primaryKey PrimaryKey, fields map[string]*fieldInfo) {
 		}
 	}
 }
+
+// sliceOf checks dst is a pointer to a slice of valid struct or struct pointer, it returns the slice and the struct type
+func sliceOf(dst interface{}) (reflect.Value, reflect.Type, error) {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		return reflect.Value{}, nil, fmt.Errorf("simple-tablestore: %T is not a pointer to slice", dst)
+	}
+	elem := v.Type().Elem().Elem()
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	if elem.Kind() != reflect.Struct {
+		return reflect.Value{}, nil, fmt.Errorf("simple-tablestore: element of %T is not a struct", dst)
+	}
+	if err := loadSchema(elem).err; err != nil {
+		return reflect.Value{}, nil, err
+	}
+	return v.Elem(), elem, nil
+}
+
+// appendRow decodes the row into a new element of slice returned by sliceOf
+func appendRow(slice reflect.Value, row *Row) {
+	elemType := slice.Type().Elem()
+	if elemType.Kind() == reflect.Ptr {
+		p := reflect.New(elemType.Elem())
+		fillStructFromRow(p.Elem(), row)
+		slice.Set(reflect.Append(slice, p))
+		return
+	}
+	v := reflect.New(elemType).Elem()
+	fillStructFromRow(v, row)
+	slice.Set(reflect.Append(slice, v))
+}
+
+// readProjection is the columns to read of Columns option
+type readProjection struct {
+	columns    []string // ColumnsToGet
+	start, end *string  // StartColumn and EndColumn
+	names      map[string]bool
+	prefixes   []string
+}
+
+// projectColumns resolves the struct fields of Columns option, nil is returned if fields is empty.
+// ColumnsToGet is the primary keys and the columns of fields, unless a ts_col_prefix field is wanted, then the
+// columns are read by the column range of its prefix. a column range can not pick several prefixes or columns
+// without reading the columns between them, so a ts_col_prefix field must be the only column wanted
+func projectColumns(s *schema, fields []string) (*readProjection, error) {
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	p := &readProjection{names: make(map[string]bool)}
+	for _, name := range fields {
+		var field *schemaField
+		for _, f := range s.fields {
+			if f.name == name {
+				field = f
+			}
+		}
+		switch {
+		case field == nil:
+			return nil, fmt.Errorf("simple-tablestore: %s has no field %s with ts tag", s.typ, name)
+		case field.isPk:
+		case field.isPrefixCol:
+			if len(p.prefixes) == 0 || p.prefixes[0] != field.columnPrefix {
+				p.prefixes = append(p.prefixes, field.columnPrefix)
+			}
+		default:
+			p.names[field.fieldName] = true
+		}
+	}
+	if len(p.prefixes) == 0 {
+		for _, f := range s.pks {
+			p.columns = append(p.columns, f.fieldName)
+		}
+		for _, f := range s.cols {
+			if p.names[f.fieldName] {
+				p.columns = append(p.columns, f.fieldName)
+			}
+		}
+		return p, nil
+	}
+	if len(p.prefixes) > 1 || len(p.names) > 0 {
+		return nil, fmt.Errorf("simple-tablestore: a ts_col_prefix field of %s can not be read with other columns by Columns", s.typ)
+	}
+	start := p.prefixes[0]
+	p.start = &start
+	if end := prefixEnd(start); end != "" {
+		p.end = &end
+	}
+	return p, nil
+}
+
+// prefixEnd returns the least string greater than all the strings with prefix, "" if there is no such string
+func prefixEnd(prefix string) string {
+	b := []byte(prefix)
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] < 0xff {
+			b[i]++
+			return string(b[:i+1])
+		}
+	}
+	return ""
+}
+
+// project drops the columns read by the column range but not wanted
+func (p *readProjection) project(columns []*AttributeColumn) []*AttributeColumn {
+	if p == nil || p.start == nil {
+		return columns
+	}
+	var wanted []*AttributeColumn
+	for _, col := range columns {
+		keep := p.names[col.ColumnName]
+		for _, prefix := range p.prefixes {
+			keep = keep || strings.HasPrefix(col.ColumnName, prefix)
+		}
+		if keep {
+			wanted = append(wanted, col)
+		}
+	}
+	return wanted
+}